@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+)
+
+// Principal é quem fez a requisição, identificado pela chave enviada no
+// header apikey (ou em ?apikey=, para clientes que não conseguem enviar
+// headers, como EventSource e Socket.IO no navegador).
+//
+//   - a chave global (EVOLUTION_APIKEY) identifica o administrador;
+//   - a chave de um tenant (ver models.Tenant) identifica o tenant;
+//   - qualquer outra chave fica em Key e pode ser o token de uma instância,
+//     validado por quem acessa a instância (ver Principal.CanAccess).
+type Principal struct {
+	Admin  bool
+	Tenant string
+	Key    string
+}
+
+type contextKey struct{}
+
+// Middleware identifica o Principal de cada requisição e o guarda no
+// contexto. Não bloqueia nada: as rotas escolhem o que exigir com Admin e
+// Tenant.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := identify(RequestKey(r))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to authenticate")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, principal)))
+	})
+}
+
+// FromRequest devolve o Principal identificado pelo Middleware.
+func FromRequest(r *http.Request) Principal {
+	principal, _ := r.Context().Value(contextKey{}).(Principal)
+	return principal
+}
+
+// Admin exige a chave global.
+func Admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !FromRequest(r).Admin {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Tenant exige a chave global ou a de um tenant; o handler restringe o que
+// o tenant enxerga.
+func Tenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := FromRequest(r)
+		if !principal.Admin && principal.Tenant == "" {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// CanAccess informa se o Principal pode operar a instância: o administrador,
+// o tenant dono dela ou quem apresentou o token da própria instância.
+func (p Principal) CanAccess(instance models.Instance) bool {
+	if p.Admin {
+		return true
+	}
+	if p.Tenant != "" && p.Tenant == instance.Tenant {
+		return true
+	}
+	return p.Key != "" && instance.Apikey != "" && equal(p.Key, instance.Apikey)
+}
+
+// CanAccessTenant informa se o Principal enxerga os recursos do tenant.
+func (p Principal) CanAccessTenant(tenant string) bool {
+	return p.Admin || (p.Tenant != "" && p.Tenant == tenant)
+}
+
+// RequestKey lê a chave enviada pelo cliente.
+func RequestKey(r *http.Request) string {
+	if key := r.Header.Get("apikey"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("apikey")
+}
+
+func identify(key string) (Principal, error) {
+	if key == "" {
+		return Principal{}, nil
+	}
+
+	if global := os.Getenv("EVOLUTION_APIKEY"); global != "" && equal(key, global) {
+		return Principal{Admin: true, Key: key}, nil
+	}
+
+	var tenants []models.Tenant
+	if err := models.DB.Where("key_hash = ?", models.HashTenantKey(key)).Limit(1).Find(&tenants).Error; err != nil {
+		return Principal{}, err
+	}
+	if len(tenants) > 0 {
+		return Principal{Tenant: tenants[0].Name, Key: key}, nil
+	}
+
+	return Principal{Key: key}, nil
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/auth"
 	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/handlers"
 	"github.com/gorilla/mux"
 )
@@ -10,10 +11,55 @@ import (
 func New() http.Handler {
 
 	router := mux.NewRouter()
+	router.Use(auth.Middleware)
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}).Methods("GET")
 
+	router.HandleFunc("/tenants", auth.Admin(handlers.GetAllTenants)).Methods("GET")
+	router.HandleFunc("/tenants", auth.Admin(handlers.CreateTenant)).Methods("POST")
+	router.HandleFunc("/tenants/{id}", auth.Admin(handlers.DeleteTenant)).Methods("DELETE")
+
+	router.HandleFunc("/servers", auth.Admin(handlers.GetAllservers)).Methods("GET")
+	router.HandleFunc("/servers", auth.Admin(handlers.RegisterServer)).Methods("POST")
+	router.HandleFunc("/servers/{id}", auth.Admin(handlers.GetServer)).Methods("GET")
+	router.HandleFunc("/servers/{id}", auth.Admin(handlers.UpdateServer)).Methods("PUT")
+	router.HandleFunc("/servers/{id}", auth.Admin(handlers.DecommissionServer)).Methods("DELETE")
+	router.HandleFunc("/servers/{id}/decommission", auth.Admin(handlers.DecommissionServer)).Methods("POST")
+	router.HandleFunc("/servers/{id}/stack", auth.Admin(handlers.GetServerStack)).Methods("GET")
+	router.HandleFunc("/servers/{id}/stack/revisions", auth.Admin(handlers.GetStackRevisions)).Methods("GET")
+	router.HandleFunc("/servers/{id}/import", auth.Admin(handlers.ImportServerInstances)).Methods("POST")
+
+	router.HandleFunc("/provisioning-jobs", auth.Admin(handlers.GetAllProvisioningJobs)).Methods("GET")
+	router.HandleFunc("/provisioning-jobs", auth.Admin(handlers.CreateProvisioningJob)).Methods("POST")
+	router.HandleFunc("/provisioning-jobs/{id}", auth.Admin(handlers.GetProvisioningJob)).Methods("GET")
+	router.HandleFunc("/provisioning-jobs/{id}/logs", auth.Admin(handlers.GetProvisioningJobLogs)).Methods("GET")
+
+	router.HandleFunc("/instances/{id}/history", handlers.GetInstanceHistory).Methods("GET")
+	router.HandleFunc("/instances/{id}/uptime", handlers.GetInstanceUptime).Methods("GET")
+
+	router.HandleFunc("/webhooks/evolution/{token}", handlers.HandleEvolutionWebhook).Methods("POST")
+
+	router.HandleFunc("/webhook-subscriptions", auth.Tenant(handlers.GetAllWebhookSubscriptions)).Methods("GET")
+	router.HandleFunc("/webhook-subscriptions", auth.Tenant(handlers.CreateWebhookSubscription)).Methods("POST")
+	router.HandleFunc("/webhook-subscriptions/{id}", auth.Tenant(handlers.GetWebhookSubscription)).Methods("GET")
+	router.HandleFunc("/webhook-subscriptions/{id}", auth.Tenant(handlers.DeleteWebhookSubscription)).Methods("DELETE")
+	router.HandleFunc("/webhook-subscriptions/{id}/deliveries", auth.Tenant(handlers.GetWebhookDeliveries)).Methods("GET")
+	router.HandleFunc("/webhook-deliveries/{id}", auth.Tenant(handlers.GetWebhookDelivery)).Methods("GET")
+	router.HandleFunc("/webhook-deliveries/{id}/replay", auth.Tenant(handlers.ReplayWebhookDelivery)).Methods("POST")
+
+	router.HandleFunc("/events", auth.Tenant(handlers.StreamEvents)).Methods("GET")
+
+	router.HandleFunc("/reconcile/last", auth.Admin(handlers.GetLastReconcile)).Methods("GET")
+	router.HandleFunc("/reconcile/drift", auth.Admin(handlers.GetDrift)).Methods("GET")
+
+	router.HandleFunc("/fleet/upgrades", auth.Admin(handlers.GetAllFleetUpgrades)).Methods("GET")
+	router.HandleFunc("/fleet/upgrades", auth.Admin(handlers.CreateFleetUpgrade)).Methods("POST")
+	router.HandleFunc("/fleet/upgrades/{id}", auth.Admin(handlers.GetFleetUpgrade)).Methods("GET")
+	router.HandleFunc("/fleet/upgrades/{id}/resume", auth.Admin(handlers.ResumeFleetUpgrade)).Methods("POST")
+	router.HandleFunc("/fleet/redeploy", auth.Admin(handlers.CreateFleetRedeploy)).Methods("POST")
+
+	router.PathPrefix("/socket.io/").HandlerFunc(handlers.HandleRealtimeProxy)
 	router.PathPrefix("/").HandlerFunc(handlers.HandleProxy)
 	http.Handle("/", router)
 
@@ -28,10 +74,5 @@ func New() http.Handler {
 	// router.HandleFunc("/delete-instance/{instanceName}", handlers.DeleteInstanceEvolution).Methods("DELETE")
 	// router.HandleFunc("/logout-instance/{instanceName}", handlers.LogoutInstanceEvolution).Methods("DELETE")
 	// router.HandleFunc("/teste/connect-state/{instanceName}", handlers.ConnectionStateInstanceEvolution).Methods("GET")
-
-	// router.HandleFunc("/servers", handlers.GetAllservers).Methods("GET")
-	// router.HandleFunc("/servers/{id}", handlers.GetServer).Methods("GET")
-	// router.HandleFunc("/servers/{id}", handlers.UpdateServer).Methods("PUT")
-	// router.HandleFunc("/servers/{id}", handlers.DeleteServer).Methods("DELETE")
 	return router
 }
@@ -0,0 +1,121 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Tipos de evento publicados no bus.
+const (
+	// TypeStatus é uma transição de estado de instância.
+	TypeStatus = "status"
+	// TypeServer é uma mudança em um servidor (Action diz qual).
+	TypeServer = "server"
+)
+
+// Ações dos eventos de servidor.
+const (
+	ServerCreated = "created"
+	ServerUpdated = "updated"
+	ServerDeleted = "deleted"
+)
+
+// Event é uma notificação publicada no bus. Em eventos de status, ID é o id
+// da transição no histórico (models.InstanceStatusChange).
+type Event struct {
+	ID           int       `json:"id,omitempty"`
+	Type         string    `json:"type"`
+	InstanceID   int       `json:"instance_id,omitempty"`
+	InstanceName string    `json:"instance_name,omitempty"`
+	ServerID     int       `json:"server_id"`
+	Tenant       string    `json:"tenant,omitempty"`
+	From         string    `json:"from,omitempty"`
+	To           string    `json:"to,omitempty"`
+	Source       string    `json:"source,omitempty"`
+	Action       string    `json:"action,omitempty"`
+	At           time.Time `json:"at"`
+}
+
+// Filter seleciona eventos por instância, servidor ou tenant. Campos vazios
+// não filtram.
+type Filter struct {
+	InstanceName string
+	ServerID     int
+	Tenant       string
+}
+
+// Match informa se o evento passa pelo filtro.
+func (f Filter) Match(event Event) bool {
+	if f.InstanceName != "" && f.InstanceName != event.InstanceName {
+		return false
+	}
+	if f.ServerID != 0 && f.ServerID != event.ServerID {
+		return false
+	}
+	if f.Tenant != "" && f.Tenant != event.Tenant {
+		return false
+	}
+	return true
+}
+
+// Bus distribui eventos para os assinantes.
+type Bus interface {
+	// Publish entrega o evento aos assinantes. Não bloqueia: assinantes
+	// lentos perdem eventos.
+	Publish(event Event) error
+	// Subscribe retorna um canal com os eventos publicados a partir de
+	// agora e uma função que encerra a assinatura (e fecha o canal).
+	Subscribe() (<-chan Event, func())
+}
+
+const (
+	Memory   = "memory"
+	Postgres = "postgres"
+)
+
+// New retorna o bus com o nome informado.
+func New(name string) (Bus, error) {
+	switch name {
+	case Memory, "":
+		return NewMemory(), nil
+	case Postgres:
+		return NewPostgres(context.Background(), PostgresDSN())
+	default:
+		return nil, fmt.Errorf("bus de eventos desconhecido: %q", name)
+	}
+}
+
+var (
+	defaultBus  Bus
+	defaultOnce sync.Once
+)
+
+// Default retorna o bus configurado em EVENT_BUS: memory (padrão), que só
+// entrega eventos dentro do próprio processo, ou postgres, que entrega para
+// todas as réplicas. Com valor inválido usa memory.
+func Default() Bus {
+	defaultOnce.Do(func() {
+		bus, err := New(os.Getenv("EVENT_BUS"))
+		if err != nil {
+			fmt.Println("Erro ao configurar o bus de eventos, usando memory:", err)
+			bus = NewMemory()
+		}
+		defaultBus = bus
+	})
+	return defaultBus
+}
+
+// Publish publica o evento no bus padrão.
+func Publish(event Event) {
+	if err := Default().Publish(event); err != nil {
+		fmt.Println("Erro ao publicar evento:", err)
+	}
+}
+
+// PublishServer publica uma mudança no servidor.
+func PublishServer(serverID int, action string) {
+	Publish(Event{Type: TypeServer, ServerID: serverID, Action: action, At: time.Now()})
+}
@@ -0,0 +1,48 @@
+package events
+
+import "sync"
+
+// subscriberBuffer é quantos eventos um assinante pode acumular antes de
+// começar a perder eventos.
+const subscriberBuffer = 64
+
+// MemoryBus é o bus em processo.
+type MemoryBus struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewMemory() *MemoryBus {
+	return &MemoryBus{subscribers: map[chan Event]struct{}{}}
+}
+
+func (b *MemoryBus) Publish(event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe() (<-chan Event, func()) {
+	subscriber := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[subscriber] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, subscriber)
+			b.mu.Unlock()
+			close(subscriber)
+		})
+	}
+}
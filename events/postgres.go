@@ -0,0 +1,122 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// postgresChannel é o canal do LISTEN/NOTIFY compartilhado pelas réplicas.
+	postgresChannel = "swarm_manager_events"
+	publishTimeout  = 5 * time.Second
+	reconnectDelay  = 5 * time.Second
+)
+
+// PostgresBus distribui os eventos entre todas as réplicas do manager com
+// LISTEN/NOTIFY. Publish faz um NOTIFY; cada réplica mantém uma conexão
+// dedicada em LISTEN e repassa o que recebe (inclusive os próprios eventos)
+// para os assinantes locais. Eventos publicados enquanto a conexão de LISTEN
+// está caída não são recebidos por aquela réplica.
+type PostgresBus struct {
+	dsn   string
+	pool  *pgxpool.Pool
+	local *MemoryBus
+}
+
+// NewPostgres cria o bus e inicia a conexão de LISTEN, que é refeita até o
+// contexto ser cancelado.
+func NewPostgres(ctx context.Context, dsn string) (*PostgresBus, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	config.MaxConns = 2
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	bus := &PostgresBus{dsn: dsn, pool: pool, local: NewMemory()}
+	go bus.listen(ctx)
+
+	return bus, nil
+}
+
+func (b *PostgresBus) Publish(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	_, err = b.pool.Exec(ctx, "SELECT pg_notify($1, $2)", postgresChannel, string(payload))
+	return err
+}
+
+func (b *PostgresBus) Subscribe() (<-chan Event, func()) {
+	return b.local.Subscribe()
+}
+
+func (b *PostgresBus) listen(ctx context.Context) {
+	for {
+		err := b.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Println("Erro na conexão LISTEN do bus de eventos, reconectando:", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (b *PostgresBus) listenOnce(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+postgresChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			fmt.Println("Evento inválido recebido do Postgres:", err)
+			continue
+		}
+		b.local.Publish(event)
+	}
+}
+
+// PostgresDSN monta a conexão com as mesmas variáveis de models.DSN (o
+// pacote models depende deste, por isso a montagem é repetida aqui).
+func PostgresDSN() string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+		os.Getenv("POSTGRES_HOST"),
+		os.Getenv("POSTGRES_USER"),
+		os.Getenv("POSTGRES_PASSWORD"),
+		os.Getenv("POSTGRES_DB"),
+		os.Getenv("POSTGRES_PORT"),
+	)
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/provisioning"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+)
+
+// Tipos de divergência entre o banco e os servidores Evolution.
+const (
+	// DriftOrphan é uma instância que existe em um servidor mas não no banco
+	// (ou uma cópia em um servidor diferente do registrado).
+	DriftOrphan = "orphan"
+	// DriftGhost é uma linha do banco cuja instância não existe em nenhum
+	// servidor.
+	DriftGhost = "ghost"
+	// DriftWrongServer é uma instância que existe, mas em outro servidor que
+	// não o registrado no banco.
+	DriftWrongServer = "wrong_server"
+)
+
+// Políticas de reparo, configuradas por tipo em DRIFT_REPAIR_ORPHAN,
+// DRIFT_REPAIR_GHOST e DRIFT_REPAIR_WRONG_SERVER. O padrão é ignore, que
+// apenas reporta.
+const (
+	RepairIgnore = "ignore"
+	// RepairImport grava o órfão no banco (orphan).
+	RepairImport = "import"
+	// RepairDelete apaga o órfão do servidor (orphan) ou a linha do banco
+	// (ghost).
+	RepairDelete = "delete"
+	// RepairMove aponta a linha do banco para o servidor onde a instância
+	// está (wrong_server).
+	RepairMove = "move"
+)
+
+// ghostGracePeriod é a idade mínima da última alteração de uma linha para
+// que ela seja considerada ghost.
+const ghostGracePeriod = 2 * time.Minute
+
+var driftRepairs = map[string][]string{
+	DriftOrphan:      {RepairIgnore, RepairImport, RepairDelete},
+	DriftGhost:       {RepairIgnore, RepairDelete},
+	DriftWrongServer: {RepairIgnore, RepairMove},
+}
+
+// Drift é uma divergência encontrada. ServerID é o servidor onde a instância
+// está (orphan, wrong_server) ou deveria estar (ghost).
+type Drift struct {
+	Type             string               `json:"type"`
+	InstanceName     string               `json:"instance_name"`
+	InstanceID       int                  `json:"instance_id,omitempty"`
+	ServerID         int                  `json:"server_id"`
+	ExpectedServerID int                  `json:"expected_server_id,omitempty"`
+	Status           models.InstanceState `json:"status,omitempty"`
+	Repair           string               `json:"repair,omitempty"`
+	RepairError      string               `json:"repair_error,omitempty"`
+
+	// evolution é a instância como informada pelo servidor (orphan).
+	evolution models.InstanceByEvolution
+}
+
+// DriftReport lista as divergências de uma rodada. Complete é false quando
+// algum servidor não respondeu; nesse caso ghosts podem estar no servidor
+// que falhou e não são reparados.
+type DriftReport struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Complete  bool      `json:"complete"`
+	Drifts    []Drift   `json:"drifts"`
+}
+
+// detectDrift compara as instâncias dos servidores com as do banco. before é
+// lido antes da consulta aos servidores e after depois: ghosts e
+// wrong_server usam before, para que uma instância apagada durante a rodada
+// não apareça como divergência; orphans usam after, para que uma instância
+// criada durante a rodada também não apareça. Servidores pulados (ver
+// reconcileSkips) não foram consultados e as linhas deles não são avaliadas.
+func detectDrift(servers []models.Server, fetched []serverFetch, before, after []models.Instance) DriftReport {
+	report := DriftReport{CheckedAt: time.Now(), Complete: true, Drifts: []Drift{}}
+
+	answered := map[int]bool{}
+	skipped := map[int]bool{}
+	found := map[string][]int{}
+	for i, server := range servers {
+		if fetched[i].Skipped != "" {
+			skipped[server.ID] = true
+			continue
+		}
+		if fetched[i].Err != nil {
+			report.Complete = false
+			continue
+		}
+		answered[server.ID] = true
+		for _, instance := range fetched[i].Instances {
+			name := instance.Instance.InstanceName
+			found[name] = append(found[name], server.ID)
+		}
+	}
+
+	known := map[int]bool{}
+	for _, server := range servers {
+		known[server.ID] = true
+	}
+
+	for _, row := range before {
+		if skipped[row.ServerID] {
+			continue
+		}
+
+		locations := found[row.Name]
+		switch {
+		case len(locations) == 0:
+			// Sem resposta do servidor registrado não dá para afirmar nada.
+			// Instâncias em criação, ou que mudaram há pouco (ex.: migração
+			// em andamento), ainda podem não ter chegado ao servidor.
+			if inFlight(row, report.CheckedAt) {
+				continue
+			}
+			if answered[row.ServerID] || !known[row.ServerID] {
+				report.Drifts = append(report.Drifts, Drift{
+					Type:         DriftGhost,
+					InstanceName: row.Name,
+					InstanceID:   row.ID,
+					ServerID:     row.ServerID,
+					Status:       row.Status,
+				})
+			}
+		case !containsID(locations, row.ServerID) && (answered[row.ServerID] || !known[row.ServerID]):
+			report.Drifts = append(report.Drifts, Drift{
+				Type:             DriftWrongServer,
+				InstanceName:     row.Name,
+				InstanceID:       row.ID,
+				ServerID:         locations[0],
+				ExpectedServerID: row.ServerID,
+				Status:           row.Status,
+			})
+		}
+	}
+
+	// home é o servidor que fica com a instância: o registrado no banco, se
+	// ela estiver lá, ou o primeiro onde foi encontrada (destino do move).
+	home := map[string]int{}
+	for _, row := range after {
+		locations := found[row.Name]
+		switch {
+		case containsID(locations, row.ServerID):
+			home[row.Name] = row.ServerID
+		case len(locations) > 0:
+			home[row.Name] = locations[0]
+		}
+	}
+
+	for i, server := range servers {
+		if fetched[i].Err != nil || fetched[i].Skipped != "" {
+			continue
+		}
+		for _, instance := range fetched[i].Instances {
+			name := instance.Instance.InstanceName
+			if owner, ok := home[name]; ok && owner == server.ID {
+				continue
+			}
+			report.Drifts = append(report.Drifts, Drift{
+				Type:         DriftOrphan,
+				InstanceName: name,
+				ServerID:     server.ID,
+				Status:       models.ParseEvolutionState(instance.Instance.Status),
+				evolution:    instance.Instance,
+			})
+		}
+	}
+
+	return report
+}
+
+// repairDrift aplica a política configurada para cada divergência e grava o
+// resultado em Repair/RepairError.
+func repairDrift(ctx context.Context, servers []models.Server, report *DriftReport) {
+	byID := map[int]models.Server{}
+	for _, server := range servers {
+		byID[server.ID] = server
+	}
+
+	for i := range report.Drifts {
+		drift := &report.Drifts[i]
+		policy := driftPolicy(drift.Type)
+		drift.Repair = policy
+
+		var err error
+		switch {
+		case policy == RepairIgnore:
+		case drift.Type == DriftGhost && !report.Complete:
+			drift.Repair = RepairIgnore
+			err = fmt.Errorf("rodada incompleta, ghost não reparado")
+		case drift.Type == DriftGhost:
+			err = deleteGhost(drift.InstanceID)
+		case drift.Type == DriftWrongServer:
+			err = models.DB.Model(&models.Instance{}).Where("id = ?", drift.InstanceID).
+				Update("server_id", drift.ServerID).Error
+		case drift.Type == DriftOrphan && policy == RepairImport:
+			err = importOrphan(byID[drift.ServerID], drift)
+		case drift.Type == DriftOrphan && policy == RepairDelete:
+			err = deleteOrphan(ctx, byID[drift.ServerID], drift.InstanceName)
+		}
+
+		if err != nil {
+			drift.RepairError = err.Error()
+		}
+	}
+}
+
+// deleteGhost apaga a linha do banco, registrando a transição para deleted.
+func deleteGhost(instanceID int) error {
+	var instance models.Instance
+	if err := models.DB.Where("id = ?", instanceID).First(&instance).Error; err != nil {
+		return err
+	}
+	if _, err := models.SetInstanceStatus(models.DB, &instance, models.StateDeleted, models.StatusSourceCron); err != nil {
+		return err
+	}
+	return models.DB.Delete(&instance).Error
+}
+
+// importOrphan grava no banco uma instância que só existia no servidor (ver
+// importInstance). Uma cópia de instância que já está no banco não é
+// importada.
+func importOrphan(server models.Server, drift *Drift) error {
+	result := importInstance(server, drift.evolution, "", false)
+	if result.Action != ImportCreate {
+		return fmt.Errorf("%s: %s", result.Action, result.Reason)
+	}
+	drift.InstanceID = result.InstanceID
+	return nil
+}
+
+// deleteOrphan apaga do servidor uma instância que não está no banco.
+func deleteOrphan(ctx context.Context, server models.Server, instanceName string) error {
+	ctx, cancel := context.WithTimeout(ctx, reconcileTimeout())
+	defer cancel()
+
+	return provisioning.DeleteEvolutionInstance(ctx, server.URL, instanceName)
+}
+
+// driftPolicy retorna a política de reparo do tipo, lida de
+// DRIFT_REPAIR_<TIPO>. Valores inválidos viram ignore.
+func driftPolicy(driftType string) string {
+	value := strings.ToLower(os.Getenv("DRIFT_REPAIR_" + strings.ToUpper(driftType)))
+	if value == "" {
+		return RepairIgnore
+	}
+	for _, allowed := range driftRepairs[driftType] {
+		if value == allowed {
+			return value
+		}
+	}
+	fmt.Printf("Política de reparo inválida para %s: %q, usando ignore\n", driftType, value)
+	return RepairIgnore
+}
+
+// inFlight informa se a linha pode estar no meio de uma operação que ainda
+// não chegou ao servidor: reservada (creating) ou alterada há menos de
+// ghostGracePeriod.
+func inFlight(row models.Instance, now time.Time) bool {
+	if row.Status == models.StateCreating {
+		return true
+	}
+	return row.UpdatedAt != nil && now.Sub(*row.UpdatedAt) < ghostGracePeriod
+}
+
+func containsID(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDrift consulta os servidores agora e retorna as divergências, sem
+// aplicar reparos. O relatório da última rodada do cron, com os reparos
+// aplicados, está em GET /reconcile/last.
+func GetDrift(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var servers []models.Server
+	if err := models.DB.Order("id").Find(&servers).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve servers")
+		return
+	}
+
+	before, err := loadInstances()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve instances")
+		return
+	}
+
+	skips, err := reconcileSkips()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve provisioning jobs")
+		return
+	}
+
+	fetched := fetchFleet(r.Context(), servers, skips)
+
+	after, err := loadInstances()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve instances")
+		return
+	}
+
+	json.NewEncoder(w).Encode(detectDrift(servers, fetched, before, after))
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/auth"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/events"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+)
+
+// sseHeartbeat é o intervalo dos comentários enviados para manter a conexão
+// aberta em proxies que derrubam conexões ociosas.
+const sseHeartbeat = 15 * time.Second
+
+// StreamEvents envia por Server-Sent Events as transições de estado das
+// instâncias, à medida que são gravadas (connect, logout, cron, webhooks...).
+// Filtros: ?instance=, ?server_id= e ?tenant=; um tenant só recebe os
+// eventos das próprias instâncias. Cada transição traz em id o id dela no
+// histórico; eventos perdidos durante uma reconexão podem ser buscados em
+// GET /instances/{id}/history. Eventos sem id (ex.: de servidores) saem sem
+// a linha id, para não mudar o Last-Event-ID do cliente.
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	filter := events.Filter{
+		InstanceName: r.URL.Query().Get("instance"),
+		Tenant:       r.URL.Query().Get("tenant"),
+	}
+	if principal := auth.FromRequest(r); !principal.Admin {
+		filter.Tenant = principal.Tenant
+	}
+	if value := r.URL.Query().Get("server_id"); value != "" {
+		serverID, err := strconv.Atoi(value)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "invalid server_id")
+			return
+		}
+		filter.ServerID = serverID
+	}
+
+	stream, unsubscribe := events.Default().Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			if !filter.Match(event) {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if event.ID != 0 {
+				if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+					return
+				}
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/auth"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultHistoryLimit = 100
+	defaultUptimeWindow = 24 * time.Hour
+)
+
+// connectedStatus é o estado em que a instância conta como conectada.
+const connectedStatus = models.StateOpen
+
+// InstanceUptime resume a conexão de uma instância em uma janela de tempo.
+// O tempo antes da primeira transição conhecida entra em UnknownSeconds.
+type InstanceUptime struct {
+	InstanceID      int                  `json:"instance_id"`
+	Since           time.Time            `json:"since"`
+	Until           time.Time            `json:"until"`
+	Status          models.InstanceState `json:"status"`
+	UptimeSeconds   float64              `json:"uptime_seconds"`
+	DowntimeSeconds float64              `json:"downtime_seconds"`
+	UnknownSeconds  float64              `json:"unknown_seconds"`
+	UptimeRatio     float64              `json:"uptime_ratio"`
+	Disconnects     int                  `json:"disconnects"`
+	LastChangeAt    *time.Time           `json:"last_change_at"`
+	DownSince       *time.Time           `json:"down_since,omitempty"`
+}
+
+// GetInstanceHistory retorna as transições de status da instância, das mais
+// recentes para as mais antigas (?limit=, padrão 100).
+func GetInstanceHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "invalid instance id")
+		return
+	}
+
+	exists, ok := authorizeInstance(w, r, id)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	var changes []models.InstanceStatusChange
+	if err := models.DB.Where("instance_id = ?", id).Order("created_at desc, id desc").Limit(limit).Find(&changes).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve instance history")
+		return
+	}
+	if len(changes) == 0 && !exists {
+		utils.RespondWithError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+
+	json.NewEncoder(w).Encode(changes)
+}
+
+// GetInstanceUptime calcula tempo conectado, tempo desconectado e número de
+// desconexões da instância entre ?since= e ?until= (RFC 3339). O padrão são
+// as últimas 24 horas.
+func GetInstanceUptime(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "invalid instance id")
+		return
+	}
+
+	until := time.Now()
+	if value := r.URL.Query().Get("until"); value != "" {
+		if until, err = time.Parse(time.RFC3339, value); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "invalid until")
+			return
+		}
+	}
+	since := until.Add(-defaultUptimeWindow)
+	if value := r.URL.Query().Get("since"); value != "" {
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "invalid since")
+			return
+		}
+	}
+	if !since.Before(until) {
+		utils.RespondWithError(w, http.StatusBadRequest, "since must be before until")
+		return
+	}
+
+	exists, ok := authorizeInstance(w, r, id)
+	if !ok {
+		return
+	}
+
+	// A transição anterior à janela dá o status no início dela.
+	var initial []models.InstanceStatusChange
+	if err := models.DB.Where("instance_id = ? AND created_at <= ?", id, since).
+		Order("created_at desc, id desc").Limit(1).Find(&initial).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve instance history")
+		return
+	}
+	hasInitial := len(initial) > 0
+
+	var changes []models.InstanceStatusChange
+	if err := models.DB.Where("instance_id = ? AND created_at > ? AND created_at <= ?", id, since, until).
+		Order("created_at, id").Find(&changes).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve instance history")
+		return
+	}
+
+	if !hasInitial && len(changes) == 0 && !exists {
+		utils.RespondWithError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+
+	uptime := InstanceUptime{InstanceID: id, Since: since, Until: until}
+
+	status, known := models.InstanceState(""), false
+	if hasInitial {
+		status, known = initial[0].To, true
+		uptime.LastChangeAt = &initial[0].CreatedAt
+	}
+
+	cursor := since
+	account := func(end time.Time) {
+		seconds := end.Sub(cursor).Seconds()
+		switch {
+		case !known:
+			uptime.UnknownSeconds += seconds
+		case status == connectedStatus:
+			uptime.UptimeSeconds += seconds
+		default:
+			uptime.DowntimeSeconds += seconds
+		}
+		cursor = end
+	}
+
+	for i := range changes {
+		change := changes[i]
+		account(change.CreatedAt)
+		if known && status == connectedStatus && isDisconnect(change.To) {
+			uptime.Disconnects++
+		}
+		status, known = change.To, true
+		uptime.LastChangeAt = &changes[i].CreatedAt
+	}
+	account(until)
+
+	uptime.Status = status
+	if known && status != connectedStatus && uptime.LastChangeAt != nil {
+		uptime.DownSince = uptime.LastChangeAt
+	}
+	if total := uptime.UptimeSeconds + uptime.DowntimeSeconds; total > 0 {
+		uptime.UptimeRatio = uptime.UptimeSeconds / total
+	}
+
+	json.NewEncoder(w).Encode(uptime)
+}
+
+// isDisconnect informa se sair de open para o estado conta como desconexão.
+// Transições como open→connecting (reconexão) ou open→deleted não contam.
+func isDisconnect(to models.InstanceState) bool {
+	return to == models.StateClosed || to == models.StateLoggedOut
+}
+
+// authorizeInstance verifica se quem chama pode ver o histórico da
+// instância e informa se ela ainda existe. O histórico de instâncias
+// apagadas só é visível ao administrador. Em caso de erro a resposta já foi
+// escrita e ok é false.
+func authorizeInstance(w http.ResponseWriter, r *http.Request, id int) (exists bool, ok bool) {
+	principal := auth.FromRequest(r)
+
+	var instances []models.Instance
+	if err := models.DB.Where("id = ?", id).Limit(1).Find(&instances).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve instance")
+		return false, false
+	}
+
+	if len(instances) == 0 {
+		if !principal.Admin {
+			utils.RespondWithError(w, http.StatusNotFound, "instance not found")
+			return false, false
+		}
+		return false, true
+	}
+
+	if !principal.CanAccess(instances[0]) {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return true, false
+	}
+	return true, true
+}
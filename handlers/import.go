@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Resultado da importação de cada instância.
+const (
+	// ImportCreate é uma instância nova (gravada, ou a gravar no dry-run).
+	ImportCreate = "create"
+	// ImportExists é uma instância já registrada neste servidor.
+	ImportExists = "exists"
+	// ImportConflict é uma instância cujo nome ou apikey já pertence a
+	// outra instância do banco; não é importada.
+	ImportConflict = "conflict"
+	// ImportError é uma falha ao gravar a instância.
+	ImportError = "error"
+)
+
+// ImportResult é o resultado da importação de uma instância.
+type ImportResult struct {
+	InstanceName string               `json:"instance_name"`
+	InstanceID   int                  `json:"instance_id,omitempty"`
+	Status       models.InstanceState `json:"status"`
+	Action       string               `json:"action"`
+	Reason       string               `json:"reason,omitempty"`
+}
+
+// ImportReport é o resultado da importação de um servidor.
+type ImportReport struct {
+	ServerID  int            `json:"server_id"`
+	DryRun    bool           `json:"dry_run"`
+	Created   int            `json:"created"`
+	Existing  int            `json:"existing"`
+	Conflicts int            `json:"conflicts"`
+	Errors    int            `json:"errors"`
+	Instances []ImportResult `json:"instances"`
+}
+
+// importInstance grava no banco uma instância encontrada no servidor, como
+// do tenant informado (vazio: só o administrador e o token da própria
+// instância a alcançam). Com dryRun nada é gravado, apenas a ação que seria
+// tomada é retornada. Instâncias sem apikey não são importadas: o proxy
+// não teria como autenticá-las, e a apikey é única no banco.
+func importInstance(server models.Server, instance models.InstanceByEvolution, tenant string, dryRun bool) ImportResult {
+	result := ImportResult{
+		InstanceName: instance.InstanceName,
+		Status:       models.ParseEvolutionState(instance.Status),
+	}
+
+	if instance.ApiKey == "" {
+		result.Action = ImportConflict
+		result.Reason = "instância sem apikey"
+		return result
+	}
+
+	var existing models.Instance
+	err := models.DB.Where("name = ?", instance.InstanceName).First(&existing).Error
+	switch {
+	case err == nil && existing.ServerID == server.ID:
+		result.Action = ImportExists
+		result.InstanceID = existing.ID
+		return result
+	case err == nil:
+		result.Action = ImportConflict
+		result.InstanceID = existing.ID
+		result.Reason = fmt.Sprintf("instância registrada no servidor %d", existing.ServerID)
+		return result
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		result.Action = ImportError
+		result.Reason = err.Error()
+		return result
+	}
+
+	err = models.DB.Where("apikey = ?", instance.ApiKey).First(&existing).Error
+	switch {
+	case err == nil:
+		result.Action = ImportConflict
+		result.Reason = fmt.Sprintf("apikey já usada pela instância %s", existing.Name)
+		return result
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		result.Action = ImportError
+		result.Reason = err.Error()
+		return result
+	}
+
+	result.Action = ImportCreate
+	if dryRun {
+		return result
+	}
+
+	created := models.Instance{
+		Name:     instance.InstanceName,
+		Status:   result.Status,
+		ServerID: server.ID,
+		Apikey:   instance.ApiKey,
+		Tenant:   tenant,
+	}
+	if err := models.DB.Create(&created).Error; err != nil {
+		result.Action = ImportError
+		result.Reason = err.Error()
+		return result
+	}
+	result.InstanceID = created.ID
+
+	if err := models.RecordInstanceCreated(models.DB, created, models.StatusSourceImport); err != nil {
+		fmt.Println("Erro ao registrar histórico da instância:", err)
+	}
+
+	return result
+}
+
+// ImportServerInstances consulta /instance/fetchInstances no servidor e
+// grava no banco as instâncias que o manager ainda não conhece, para que
+// passem a ser roteadas. ?tenant= define o tenant dono das instâncias
+// importadas. Com ?dry_run=true apenas retorna o que seria feito.
+func ImportServerInstances(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id := mux.Vars(r)["id"]
+	var server models.Server
+
+	if err := models.DB.Where("id = ?", id).First(&server).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	tenant := r.URL.Query().Get("tenant")
+	if tenant != "" {
+		var count int64
+		if err := models.DB.Model(&models.Tenant{}).Where("name = ?", tenant).Count(&count).Error; err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve tenant")
+			return
+		}
+		if count == 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "unknown tenant")
+			return
+		}
+	}
+
+	fetched := fetchServer(r.Context(), server)
+	if fetched.Err != nil {
+		utils.RespondWithError(w, http.StatusBadGateway, "Failed to fetch instances: "+fetched.Err.Error())
+		return
+	}
+
+	report := ImportReport{ServerID: server.ID, DryRun: dryRun, Instances: []ImportResult{}}
+	for _, instance := range fetched.Instances {
+		result := importInstance(server, instance.Instance, tenant, dryRun)
+		switch result.Action {
+		case ImportCreate:
+			report.Created++
+		case ImportExists:
+			report.Existing++
+		case ImportConflict:
+			report.Conflicts++
+		case ImportError:
+			report.Errors++
+		}
+		report.Instances = append(report.Instances, result)
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
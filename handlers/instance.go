@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,7 +15,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/auth"
 	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/placement"
 	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
@@ -23,19 +29,29 @@ func HandleProxy(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		switch path {
+		case "/instance":
+			if r.URL.Path == "/instance/fetchInstances" {
+				FetchInstancesEvolution(w, r)
+			} else {
+				ProxyInstanceEvolution(w, r)
+			}
 		case "/instance/connectionState":
 			ConnectionStateInstanceEvolution(w, r)
 		case "/instance/connect":
 			ConnectInstanceEvolution(w, r)
 		default:
-			http.NotFound(w, r)
+			ProxyInstanceEvolution(w, r)
 		}
 	case http.MethodPost:
 		switch path {
 		case "/instance":
-			CreateInstanceEvolution(w, r)
+			if r.URL.Path == "/instance/create" {
+				CreateInstanceEvolution(w, r)
+			} else {
+				ProxyInstanceEvolution(w, r)
+			}
 		default:
-			http.NotFound(w, r)
+			ProxyInstanceEvolution(w, r)
 		}
 	case http.MethodDelete:
 		switch path {
@@ -44,17 +60,17 @@ func HandleProxy(w http.ResponseWriter, r *http.Request) {
 		case "/instance/delete":
 			DeleteInstanceEvolution(w, r)
 		default:
-			http.NotFound(w, r)
+			ProxyInstanceEvolution(w, r)
 		}
 	case http.MethodPut:
 		switch path {
 		case "/instance/restart":
-			LogoutInstanceEvolution(w, r)
+			RestartInstanceEvolution(w, r)
 		default:
-			http.NotFound(w, r)
+			ProxyInstanceEvolution(w, r)
 		}
 	default:
-		http.Error(w, "Método não suportado", http.StatusMethodNotAllowed)
+		ProxyInstanceEvolution(w, r)
 	}
 }
 
@@ -66,12 +82,6 @@ func removeLastItemAfterLastSlash(url string) string {
 	return strings.Join(parts, "/")
 }
 
-func getLastItemAfterLastSlash(url string) string {
-	parts := strings.Split(url, "/")
-	lastItem := parts[len(parts)-1]
-	return lastItem
-}
-
 func GetAllInstances(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -161,7 +171,15 @@ func UpdateInstance(w http.ResponseWriter, r *http.Request) {
 		instance.Name = input.Name
 	}
 	if input.Status != "" {
-		instance.Status = input.Status
+		_, err := models.SetInstanceStatus(models.DB, &instance, models.InstanceState(input.Status), models.StatusSourceAPI)
+		if errors.Is(err, models.ErrInvalidTransition) {
+			utils.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update instance")
+			return
+		}
 	}
 	if input.UpdatedAt != nil {
 		instance.UpdatedAt = input.UpdatedAt
@@ -215,264 +233,212 @@ func CreateInstanceEvolution(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var payload models.InstanceRequest
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Erro ao decodificar o corpo da solicitação JSON", http.StatusBadRequest)
+	// Criar instâncias exige a chave global ou a de um tenant: a criação é
+	// repassada com a chave global, que o cliente nunca recebe.
+	principal := auth.FromRequest(r)
+	if !principal.Admin && principal.Tenant == "" {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
 		return
 	}
-	serverUrl, serverId := verifyServerAvailability()
+	tenant := principal.Tenant
+	if principal.Admin {
+		tenant = r.Header.Get("X-Tenant-ID")
+	}
 
-	url := serverUrl + r.URL.Path
-	payloadBytes, err := json.Marshal(payload)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Erro ao codificar o payload:"+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Erro ao ler o corpo da solicitação: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	req, err := http.NewRequest(r.Method, url, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		http.Error(w, "Erro ao criar a solicitação HTTP:"+err.Error(), http.StatusInternalServerError)
+	var payload models.InstanceRequest
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "Erro ao decodificar o corpo da solicitação JSON", http.StatusBadRequest)
 		return
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
+	// Sem token a Evolution gera um que o manager não conhece, e a instância
+	// não poderia ser acessada pelo proxy; o manager gera e envia o token.
+	if payload.Token == "" {
+		body, payload.Token, err = withGeneratedToken(body)
+		if err != nil {
+			http.Error(w, "Erro ao gerar o token da instância: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Erro ao enviar a solicitação HTTP:"+err.Error(), http.StatusInternalServerError)
+	reserved, serverUrl, err := reserveInstance(models.Instance{
+		Name:   payload.InstanceName,
+		Status: models.StateCreating,
+		Apikey: payload.Token,
+		Tenant: tenant,
+	})
+	if err == placement.ErrNoServerAvailable {
+		http.Error(w, "Nenhum servidor disponível", http.StatusServiceUnavailable)
 		return
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		http.Error(w, "Erro ao ler a resposta da solicitação HTTP:"+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Erro ao reservar servidor para a instância: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	newInstance := models.Instance{
-		Name:     payload.InstanceName,
-		Status:   "open",
-		ServerID: serverId,
-		Apikey:   payload.Token,
-	}
+	// O corpo é repassado como veio (só com o token acrescentado, se foi
+	// gerado), incluindo campos que o manager não conhece (webhook, number...).
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
 
-	err = CreateInstance(newInstance)
+	// A vaga já está reservada; se a Evolution não criar a instância, a
+	// reserva é desfeita para não ocupar capacidade.
+	created := false
+	proxy, err := newEvolutionProxy(serverUrl, os.Getenv("EVOLUTION_APIKEY"), func(resp *http.Response) error {
+		created = resp.StatusCode >= 200 && resp.StatusCode < 300
+		return nil
+	})
 	if err != nil {
-		http.Error(w, "Erro ao criar a instância: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.WriteHeader(resp.StatusCode)
-	w.Write(body)
-}
-
-func DeleteInstanceEvolution(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		releaseInstance(reserved)
+		http.Error(w, "Erro ao criar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	instanceName := getLastItemAfterLastSlash(r.URL.Path)
+	proxy.ServeHTTP(w, r)
 
-	if instanceName == "" {
-		http.Error(w, "Nome da instância não fornecido", http.StatusBadRequest)
+	if !created {
+		releaseInstance(reserved)
 		return
 	}
 
-	serverUrl, error := findIntanceByIntanceName(instanceName)
-	if error != nil {
-		http.Error(w, "Servidor não encontrado", http.StatusNotFound)
-		return
+	// Com qrcode a Evolution já gera o QR code; sem ele a instância fica
+	// desconectada até o connect.
+	next := models.StateClosed
+	if payload.QRCode {
+		next = models.StateQRPending
 	}
-
-	url := serverUrl + r.URL.Path
-	req, err := http.NewRequest(r.Method, url, nil)
-	if err != nil {
-		http.Error(w, "Erro ao criar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
+	if err := store.Created(reserved, next); err != nil {
+		fmt.Println("Erro ao atualizar status da instância:", err)
 	}
+}
 
-	req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
+// withGeneratedToken acrescenta um token aleatório ao corpo da criação,
+// preservando os demais campos.
+func withGeneratedToken(body []byte) ([]byte, string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, "", err
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Erro ao enviar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
 	}
-	defer resp.Body.Close()
+	token := strings.ToUpper(hex.EncodeToString(random))
 
-	body, err := io.ReadAll(resp.Body)
+	encoded, err := json.Marshal(token)
 	if err != nil {
-		http.Error(w, "Erro ao ler a resposta da solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
+		return nil, "", err
 	}
+	fields["token"] = encoded
 
-	models.DB.Table("instances").Where("instances.name = ?", instanceName).Delete(&models.Instance{})
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.WriteHeader(resp.StatusCode)
-	w.Write(body)
+	body, err = json.Marshal(fields)
+	return body, token, err
 }
 
-func ConnectionStateInstanceEvolution(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+func DeleteInstanceEvolution(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
 		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
 		return
 	}
 
-	instanceName := getLastItemAfterLastSlash(r.URL.Path)
+	proxyToInstanceServer(w, r, func(instanceName string, resp *http.Response) error {
+		var instance models.Instance
+		if err := models.DB.Where("name = ?", instanceName).First(&instance).Error; err != nil {
+			return err
+		}
+		if _, err := models.SetInstanceStatus(models.DB, &instance, models.StateDeleted, models.StatusSourceDelete); err != nil {
+			return err
+		}
+		return models.DB.Delete(&instance).Error
+	})
+}
 
-	if instanceName == "" {
-		http.Error(w, "Nome da instância não fornecido", http.StatusBadRequest)
+func ConnectionStateInstanceEvolution(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
 		return
 	}
 
-	serverUrl, error := findIntanceByIntanceName(instanceName)
-	if error != nil {
-		http.Error(w, "Servidor não encontrado", http.StatusNotFound)
-		return
-	}
+	proxyToInstanceServer(w, r, nil)
+}
 
-	url := serverUrl + r.URL.Path
-	req, err := http.NewRequest(r.Method, url, nil)
-	if err != nil {
-		http.Error(w, "Erro ao criar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
+// FetchInstancesEvolution atende /instance/fetchInstances. Com o token de
+// uma instância ou ?instanceName= a rota é repassada ao servidor da
+// instância; com a chave global ou a de um tenant, as listas de todos os
+// servidores (ou dos servidores do tenant) são juntadas, e o tenant só
+// recebe as próprias instâncias.
+func FetchInstancesEvolution(w http.ResponseWriter, r *http.Request) {
+	principal := auth.FromRequest(r)
+	if r.URL.Query().Get("instanceName") != "" || (!principal.Admin && principal.Tenant == "") {
+		proxyToInstanceServer(w, r, nil)
+		return
+	}
+
+	var owned map[string]bool
+	query := models.DB.Order("id")
+	if !principal.Admin {
+		var instances []models.Instance
+		if err := models.DB.Where("tenant = ?", principal.Tenant).Find(&instances).Error; err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve instances")
+			return
+		}
+		owned = map[string]bool{}
+		var serverIDs []int
+		for _, instance := range instances {
+			owned[instance.Name] = true
+			serverIDs = append(serverIDs, instance.ServerID)
+		}
+		query = query.Where("id IN ?", append(serverIDs, 0))
 	}
 
-	req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Erro ao enviar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
+	var servers []models.Server
+	if err := query.Find(&servers).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve servers")
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "Erro ao ler a resposta da solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
+	// A lista é montada a partir do JSON de cada servidor para não perder os
+	// campos que o manager não conhece.
+	all := []json.RawMessage{}
+	for _, server := range servers {
+		instances, err := fetchServerInstancesRaw(r.Context(), server)
+		if err != nil {
+			fmt.Printf("Erro ao buscar instâncias do servidor %s: %v\n", server.URL, err)
+			continue
+		}
+		for _, raw := range instances {
+			if owned != nil {
+				var instance models.ServerInstance
+				if json.Unmarshal(raw, &instance) != nil || !owned[instance.Instance.InstanceName] {
+					continue
+				}
+			}
+			all = append(all, raw)
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.WriteHeader(resp.StatusCode)
-	w.Write(body)
-}
-
-func findIntanceByIntanceName(instanceName string) (string, error) {
-	serverUrl := models.UrlServer
-
-	error := models.DB.Table("servers").
-		Select("servers.url").
-		Joins("LEFT JOIN instances on servers.id = instances.server_id").
-		Where("instances.name = ?", instanceName).
-		Group("servers.url").
-		First(&serverUrl).
-		Error
-
-	if error != nil {
-		return "", error
-	}
-	return serverUrl.URL, nil
+	json.NewEncoder(w).Encode(all)
 }
 
 func RestartInstanceEvolution(w http.ResponseWriter, r *http.Request) {
-	instanceName := getLastItemAfterLastSlash(r.URL.Path)
-
-	if instanceName == "" {
-		http.Error(w, "Nome da instância não fornecido", http.StatusBadRequest)
-		return
-	}
-
-	serverUrl, error := findIntanceByIntanceName(instanceName)
-	if error != nil {
-		http.Error(w, "Servidor não encontrado", http.StatusNotFound)
-		return
-	}
-
-	url := serverUrl + r.URL.Path
-	req, err := http.NewRequest(r.Method, url, nil)
-	if err != nil {
-		http.Error(w, "Erro ao criar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Erro ao enviar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "Erro ao ler a resposta da solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	UpdateStatusInstance("name", instanceName, "close")
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.WriteHeader(resp.StatusCode)
-	w.Write(body)
+	proxyToInstanceServer(w, r, func(instanceName string, resp *http.Response) error {
+		return UpdateStatusInstance("name", instanceName, models.StateConnecting, models.StatusSourceRestart)
+	})
 }
 
 func LogoutInstanceEvolution(w http.ResponseWriter, r *http.Request) {
-	instanceName := getLastItemAfterLastSlash(r.URL.Path)
-
-	if instanceName == "" {
-		http.Error(w, "Nome da instância não fornecido", http.StatusBadRequest)
-		return
-	}
-
-	serverUrl, error := findIntanceByIntanceName(instanceName)
-	if error != nil {
-		http.Error(w, "Servidor não encontrado", http.StatusNotFound)
-		return
-	}
-
-	url := serverUrl + r.URL.Path
-	req, err := http.NewRequest(r.Method, url, nil)
-	if err != nil {
-		http.Error(w, "Erro ao criar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Erro ao enviar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "Erro ao ler a resposta da solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	UpdateStatusInstance("name", instanceName, "close")
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.WriteHeader(resp.StatusCode)
-	w.Write(body)
+	proxyToInstanceServer(w, r, func(instanceName string, resp *http.Response) error {
+		return UpdateStatusInstance("name", instanceName, models.StateLoggedOut, models.StatusSourceLogout)
+	})
 }
 
 func ConnectInstanceEvolution(w http.ResponseWriter, r *http.Request) {
@@ -481,98 +447,9 @@ func ConnectInstanceEvolution(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	instanceName := getLastItemAfterLastSlash(r.URL.Path)
-
-	if instanceName == "" {
-		http.Error(w, "Nome da instância não fornecido", http.StatusBadRequest)
-		return
-	}
-
-	serverUrl, error := findIntanceByIntanceName(instanceName)
-	if error != nil {
-		http.Error(w, "Servidor não encontrado", http.StatusNotFound)
-		return
-	}
-
-	url := serverUrl + r.URL.Path
-
-	req, err := http.NewRequest(r.Method, url, nil)
-	if err != nil {
-		http.Error(w, "Erro ao criar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Erro ao enviar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "Erro ao ler a resposta da solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	UpdateStatusInstance("name", instanceName, "open")
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	w.WriteHeader(resp.StatusCode)
-
-	w.Write(body)
-}
-
-func FetchInstances() {
-	fmt.Println("Start Cron")
-	var servers []models.Server
-
-	err := models.DB.Table("servers s").
-		Distinct("s.url").
-		Find(&servers).Error
-
-	if err != nil {
-		fmt.Println("Erro ao executar a consulta:", err)
-	}
-
-	for _, server := range servers {
-		client := &http.Client{}
-
-		req, err := http.NewRequest("GET", server.URL+"/instance/fetchInstances", nil)
-		if err != nil {
-			fmt.Println("Erro ao criar requisição HTTP:", err)
-			continue // Continue para o próximo servidor em caso de erro na requisição
-		}
-		req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
-
-		resp, err := client.Do(req)
-		if err != nil {
-			fmt.Println("Erro ao fazer requisição HTTP:", err)
-			continue // Continue para o próximo servidor em caso de erro na requisição
-		}
-		defer resp.Body.Close()
-
-		var instances []models.ServerInstance
-		if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
-			fmt.Println("Erro ao decodificar resposta JSON:", err)
-			continue // Continue para o próximo servidor em caso de erro na decodificação JSON
-		}
-		fmt.Print("instance", instances)
-
-		for _, instance := range instances {
-			err := UpdateStatusInstance("apikey", instance.Instance.ApiKey, instance.Instance.Status)
-			if err != nil {
-				fmt.Println("Erro ao atualizar status da instância:", err)
-				// Você pode decidir continuar para o próximo servidor ou retornar o erro, dependendo dos requisitos do seu aplicativo
-			}
-		}
-	}
-	fmt.Println("End Cron")
+	proxyToInstanceServer(w, r, func(instanceName string, resp *http.Response) error {
+		return UpdateStatusInstance("name", instanceName, models.StateQRPending, models.StatusSourceConnect)
+	})
 }
 
 func DeleteAllInstances() {
@@ -607,7 +484,7 @@ func DeleteAllInstances() {
 		var instances []models.ServerInstance
 		if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
 			fmt.Println("Erro ao decodificar resposta JSON:", err)
-			go FetchInstances()
+			go FetchInstances(context.Background())
 			return // Continue para o próximo servidor em caso de erro na decodificação JSON
 		}
 
@@ -629,44 +506,22 @@ func DeleteAllInstances() {
 	}
 }
 
-func UpdateStatusInstance(field string, fieldValue string, status string) error {
+// UpdateStatusInstance leva a instância ao novo estado e registra a transição
+// no histórico com a origem informada (ver models.SetInstanceStatus). Uma
+// transição não permitida é apenas registrada no log: a operação já foi feita
+// na Evolution e a resposta não deve falhar por isso (ex.: connect em uma
+// instância já conectada não volta para qr_pending).
+func UpdateStatusInstance(field string, fieldValue string, status models.InstanceState, source string) error {
 	var instance models.Instance
 	result := models.DB.Where(field+" = ?", fieldValue).First(&instance)
 	if result.Error != nil {
 		return result.Error
 	}
 
-	instance.Status = status
-
-	if err := models.DB.Save(&instance).Error; err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func verifyServerAvailability() (string, int) {
-	var servers []models.Result
-
-	err := models.DB.Table("servers").
-		Select("servers.url, servers.id, COUNT(instances.id) AS count_open").
-		Joins("LEFT JOIN instances ON servers.id = instances.server_id AND instances.status = ?", "open").
-		Group("servers.url, servers.id").
-		Order("count_open DESC").
-		Scan(&servers).Error
-
-	if err != nil {
-		fmt.Println("Erro ao executar a consulta:", err)
+	_, err := models.SetInstanceStatus(models.DB, &instance, status, source)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		fmt.Printf("Status da instância %s mantido (%s): %s\n", instance.Name, source, err)
+		return nil
 	}
-
-	for _, server := range servers {
-		if server.CountOpen == 10 {
-			go CreateServerHetzner()
-		}
-		if server.CountOpen < 20 {
-			return server.URL, server.ID
-		}
-	}
-
-	return servers[0].URL, servers[0].ID
+	return err
 }
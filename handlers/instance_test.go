@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/auth"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/placement"
+)
+
+const testGlobalKey = "global-key"
+
+// memoryStore é um instanceStore em memória com a mesma regra do
+// placement.Reserve: a escolha e a gravação acontecem sob um único lock.
+// Aqui ele testa o handler (reserva, liberação, chamadas à Evolution); o
+// lock do Postgres é testado em placement.TestReserveParallel.
+type memoryStore struct {
+	mu        sync.Mutex
+	servers   []models.Result
+	instances map[int]models.Instance
+	nextID    int
+	// peak é o maior número de reservas simultâneas por servidor.
+	peak map[int]int
+}
+
+func newMemoryStore(servers ...models.Result) *memoryStore {
+	return &memoryStore{servers: servers, instances: map[int]models.Instance{}, peak: map[int]int{}}
+}
+
+func (s *memoryStore) Reserve(input models.Instance) (models.Instance, string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	servers := s.load()
+	server, ok := placement.Default().Pick(servers)
+	if !ok {
+		return models.Instance{}, "", 0, placement.ErrNoServerAvailable
+	}
+
+	s.nextID++
+	input.ID = s.nextID
+	input.ServerID = server.ID
+	s.instances[input.ID] = input
+
+	count := s.count(server.ID)
+	if count > s.peak[server.ID] {
+		s.peak[server.ID] = count
+	}
+
+	freeSlots := 0
+	for _, server := range s.load() {
+		freeSlots += placement.Capacity(server) - server.CountOpen
+	}
+	return input, server.URL, freeSlots, nil
+}
+
+func (s *memoryStore) Release(instance models.Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.instances, instance.ID)
+	return nil
+}
+
+func (s *memoryStore) Created(instance models.Instance, next models.InstanceState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.instances[instance.ID]
+	if !ok {
+		return fmt.Errorf("instância %d não reservada", instance.ID)
+	}
+	stored.Status = next
+	s.instances[instance.ID] = stored
+	return nil
+}
+
+func (s *memoryStore) load() []models.Result {
+	servers := make([]models.Result, len(s.servers))
+	for i, server := range s.servers {
+		server.CountOpen = s.count(server.ID)
+		servers[i] = server
+	}
+	return servers
+}
+
+func (s *memoryStore) count(serverID int) int {
+	count := 0
+	for _, instance := range s.instances {
+		if instance.ServerID == serverID {
+			count++
+		}
+	}
+	return count
+}
+
+// stubEvolution simula o /instance/create da Evolution: nomes começados por
+// "fail" recebem 500.
+type stubEvolution struct {
+	calls atomic.Int32
+	names sync.Map
+}
+
+func (e *stubEvolution) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.calls.Add(1)
+
+	if r.Method != http.MethodPost || r.URL.Path != "/instance/create" {
+		http.Error(w, "rota inesperada", http.StatusNotFound)
+		return
+	}
+	if r.Header.Get("apikey") != testGlobalKey {
+		http.Error(w, "apikey inválida", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.InstanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.Token == "" {
+		http.Error(w, "token ausente", http.StatusBadRequest)
+		return
+	}
+	if _, loaded := e.names.LoadOrStore(payload.InstanceName, true); loaded {
+		http.Error(w, "instância duplicada", http.StatusConflict)
+		return
+	}
+
+	// Segura a resposta para que as reservas das requisições se sobreponham.
+	time.Sleep(10 * time.Millisecond)
+
+	if strings.HasPrefix(payload.InstanceName, "fail") {
+		http.Error(w, "erro na evolution", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, `{"instance":{"instanceName":%q}}`, payload.InstanceName)
+}
+
+// setupCreate troca o store e o provisionamento pelos de teste e devolve o
+// handler de criação com a autenticação do manager.
+func setupCreate(t *testing.T, memory *memoryStore) http.Handler {
+	t.Helper()
+	t.Setenv("EVOLUTION_APIKEY", testGlobalKey)
+	t.Setenv("PROVISION_MIN_FREE_SLOTS", "0")
+
+	previousStore, previousEnqueue := store, enqueueProvisioning
+	store = memory
+	enqueueProvisioning = func() error { return nil }
+	t.Cleanup(func() {
+		store, enqueueProvisioning = previousStore, previousEnqueue
+	})
+
+	return auth.Middleware(http.HandlerFunc(HandleProxy))
+}
+
+func postCreate(handler http.Handler, name string) int {
+	body := fmt.Sprintf(`{"instanceName":%q,"integration":"WHATSAPP-BAILEYS"}`, name)
+	req := httptest.NewRequest(http.MethodPost, "/instance/create", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", testGlobalKey)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestCreateInstanceParallel(t *testing.T) {
+	evolution := &stubEvolution{}
+	upstream := httptest.NewServer(evolution)
+	defer upstream.Close()
+
+	const capacity = 5
+	memory := newMemoryStore(
+		models.Result{ID: 1, URL: upstream.URL, Capacity: capacity},
+		models.Result{ID: 2, URL: upstream.URL, Capacity: capacity},
+	)
+	handler := setupCreate(t, memory)
+
+	var names []string
+	for i := 0; i < 20; i++ {
+		names = append(names, fmt.Sprintf("ok-%d", i))
+	}
+	for i := 0; i < 6; i++ {
+		names = append(names, fmt.Sprintf("fail-%d", i))
+	}
+
+	codes := make([]int, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			codes[i] = postCreate(handler, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	counts := map[int]int{}
+	for i, code := range codes {
+		counts[code]++
+		if strings.HasPrefix(names[i], "fail") && code == http.StatusCreated {
+			t.Errorf("%s criada apesar do erro na Evolution", names[i])
+		}
+	}
+
+	if counts[http.StatusCreated] == 0 {
+		t.Fatalf("nenhuma instância criada: %v", counts)
+	}
+	if counts[http.StatusCreated]+counts[http.StatusInternalServerError]+counts[http.StatusServiceUnavailable] != len(names) {
+		t.Errorf("respostas inesperadas: %v", counts)
+	}
+
+	// Só quem reservou vaga chega à Evolution.
+	if got, want := int(evolution.calls.Load()), counts[http.StatusCreated]+counts[http.StatusInternalServerError]; got != want {
+		t.Errorf("Evolution recebeu %d criações, want %d", got, want)
+	}
+
+	// Nenhum servidor passou da capacidade, nem durante as requisições.
+	for serverID, peak := range memory.peak {
+		if peak > capacity {
+			t.Errorf("servidor %d chegou a %d reservas (capacidade %d)", serverID, peak, capacity)
+		}
+	}
+
+	// As falhas foram liberadas e as criadas saíram de creating.
+	if len(memory.instances) != counts[http.StatusCreated] {
+		t.Errorf("%d reservas restantes, want %d", len(memory.instances), counts[http.StatusCreated])
+	}
+	for _, instance := range memory.instances {
+		if strings.HasPrefix(instance.Name, "fail") {
+			t.Errorf("reserva de %s não foi liberada", instance.Name)
+		}
+		if instance.Status != models.StateClosed {
+			t.Errorf("%s ficou em %s, want %s", instance.Name, instance.Status, models.StateClosed)
+		}
+	}
+}
+
+func TestCreateInstanceReleasesOnUpstreamFailure(t *testing.T) {
+	evolution := &stubEvolution{}
+	upstream := httptest.NewServer(evolution)
+	defer upstream.Close()
+
+	memory := newMemoryStore(models.Result{ID: 1, URL: upstream.URL, Capacity: 1})
+	handler := setupCreate(t, memory)
+
+	if code := postCreate(handler, "fail-only"); code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want %d", code, http.StatusInternalServerError)
+	}
+	if len(memory.instances) != 0 {
+		t.Fatalf("reserva não liberada: %v", memory.instances)
+	}
+
+	// A vaga liberada pode ser usada pela próxima criação.
+	if code := postCreate(handler, "ok-after-fail"); code != http.StatusCreated {
+		t.Fatalf("status %d, want %d", code, http.StatusCreated)
+	}
+	if code := postCreate(handler, "ok-no-room"); code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d com o servidor cheio, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestCreateInstanceRequiresAuthentication(t *testing.T) {
+	evolution := &stubEvolution{}
+	upstream := httptest.NewServer(evolution)
+	defer upstream.Close()
+
+	memory := newMemoryStore(models.Result{ID: 1, URL: upstream.URL, Capacity: 1})
+	handler := setupCreate(t, memory)
+
+	req := httptest.NewRequest(http.MethodPost, "/instance/create", strings.NewReader(`{"instanceName":"anon"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if evolution.calls.Load() != 0 || len(memory.instances) != 0 {
+		t.Fatal("criação sem autenticação chegou à Evolution")
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/provisioning"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func GetAllProvisioningJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	query := models.DB.Order("id DESC")
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if state := r.URL.Query().Get("state"); state != "" {
+		query = query.Where("state = ?", state)
+	}
+
+	var jobs []models.ProvisioningJob
+	if err := query.Find(&jobs).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve provisioning jobs")
+		return
+	}
+
+	json.NewEncoder(w).Encode(jobs)
+}
+
+func GetProvisioningJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id := mux.Vars(r)["id"]
+	var job models.ProvisioningJob
+
+	if err := models.DB.Where("id = ?", id).First(&job).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Provisioning job not found")
+		return
+	}
+
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetProvisioningJobLogs retorna a saída de cada etapa executada no servidor
+// pelo job, na ordem de execução.
+func GetProvisioningJobLogs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id := mux.Vars(r)["id"]
+
+	var logs []models.ProvisioningLog
+	if err := models.DB.Where("job_id = ?", id).Order("id").Find(&logs).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve provisioning logs")
+		return
+	}
+
+	json.NewEncoder(w).Encode(logs)
+}
+
+// CreateProvisioningJob pede um novo servidor manualmente. Se já houver um
+// job em andamento, ele é retornado no lugar de um novo.
+func CreateProvisioningJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	job, err := provisioning.Enqueue()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create provisioning job")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// DecommissionServer cria um job que remove o servidor por completo. Com
+// ?migrate=true as instâncias são movidas para outros servidores; sem ele o
+// job espera que elas sejam removidas. Atende também DELETE /servers/{id}:
+// remover só a linha do banco deixaria VM, DNS e instâncias para trás.
+func DecommissionServer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid server id")
+		return
+	}
+
+	migrate := r.URL.Query().Get("migrate") == "true"
+
+	job, err := provisioning.EnqueueDecommission(id, migrate)
+	if err == gorm.ErrRecordNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create decommission job")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/auth"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+)
+
+// proxyFlushInterval controla de quanto em quanto tempo o corpo da resposta é
+// repassado ao cliente, para que downloads grandes não fiquem presos em buffer.
+const proxyFlushInterval = 100 * time.Millisecond
+
+// newEvolutionProxy cria um reverse proxy para o servidor Evolution informado.
+// Método, caminho, query string, headers e corpos são repassados em streaming
+// nos dois sentidos; a chave do cliente (header ou ?apikey=) é substituída
+// por apikey, que é sempre uma chave que o próprio cliente já provou ter
+// acesso (ver proxyToInstanceServer).
+// onResponse, quando informado, é chamado antes de a resposta ser enviada ao
+// cliente; um erro retornado vira 502.
+func newEvolutionProxy(serverUrl string, apikey string, onResponse func(*http.Response) error) (*httputil.ReverseProxy, error) {
+	target, err := url.Parse(serverUrl)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("url de servidor inválida: %q", serverUrl)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+
+			query := pr.Out.URL.Query()
+			if query.Has("apikey") {
+				query.Del("apikey")
+				pr.Out.URL.RawQuery = query.Encode()
+			}
+			pr.Out.Header.Set("apikey", apikey)
+		},
+		FlushInterval: proxyFlushInterval,
+		ModifyResponse: func(resp *http.Response) error {
+			resp.Header.Set("Access-Control-Allow-Origin", "*")
+			if onResponse != nil {
+				return onResponse(resp)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, "Erro ao enviar a solicitação HTTP: "+err.Error(), http.StatusBadGateway)
+		},
+	}
+
+	return proxy, nil
+}
+
+// proxyToInstanceServer resolve a instância da rota e repassa a requisição
+// para o servidor dono dela. O cliente precisa poder operar a instância (ver
+// auth.Principal.CanAccess); a requisição segue com o token da instância,
+// então a Evolution só aceita operações sobre ela, e nunca com a chave global
+// em um caminho escolhido pelo cliente. onSuccess é chamado apenas para
+// respostas 2xx, antes de o corpo ser enviado ao cliente.
+func proxyToInstanceServer(w http.ResponseWriter, r *http.Request, onSuccess func(instanceName string, resp *http.Response) error) {
+	principal := auth.FromRequest(r)
+
+	instance, err := instanceFromRequest(r, principal)
+	if err == errNoInstanceName {
+		http.Error(w, "Nome da instância não fornecido", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Instância não encontrada", http.StatusNotFound)
+		return
+	}
+
+	if !principal.CanAccess(instance) {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+
+	// Instâncias antigas podem não ter o token gravado; nesse caso só o
+	// administrador passa por CanAccess e segue com a própria chave.
+	apikey := instance.Apikey
+	if apikey == "" {
+		apikey = principal.Key
+	}
+
+	var onResponse func(*http.Response) error
+	if onSuccess != nil {
+		onResponse = func(resp *http.Response) error {
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				return nil
+			}
+			return onSuccess(instance.Name, resp)
+		}
+	}
+
+	proxy, err := newEvolutionProxy(instance.Server.URL, apikey, onResponse)
+	if err != nil {
+		http.Error(w, "Erro ao criar a solicitação HTTP: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+var errNoInstanceName = errors.New("nome da instância não fornecido")
+
+// instanceFromRequest carrega a instância da rota, com o servidor. Rotas sem
+// o nome da instância (ex.: /instance/fetchInstances) usam a instância dona
+// do token enviado pelo cliente.
+func instanceFromRequest(r *http.Request, principal auth.Principal) (models.Instance, error) {
+	var instance models.Instance
+
+	query := models.DB.Preload("Server")
+	if name := instanceNameFromRequest(r); name != "" {
+		query = query.Where("name = ?", name)
+	} else if principal.Key != "" && !principal.Admin && principal.Tenant == "" {
+		query = query.Where("apikey = ?", principal.Key)
+	} else {
+		return instance, errNoInstanceName
+	}
+
+	err := query.First(&instance).Error
+	return instance, err
+}
+
+// ProxyInstanceEvolution repassa qualquer rota da Evolution API para o servidor
+// dono da instância, preservando método, caminho, query string, headers e body.
+func ProxyInstanceEvolution(w http.ResponseWriter, r *http.Request) {
+	proxyToInstanceServer(w, r, nil)
+}
+
+// HandleRealtimeProxy encaminha as conexões Socket.IO/WebSocket da Evolution
+// para o servidor dono da instância. O caminho do Socket.IO é sempre
+// /socket.io/ (a instância vai no namespace, dentro do protocolo), por isso o
+// cliente precisa informar ?instanceName= (e a chave em ?apikey=, já que o
+// navegador não envia headers no WebSocket) na conexão, por exemplo:
+//
+//	io("https://manager/minha-instancia", { query: { instanceName: "minha-instancia", apikey: "<token>" } })
+//
+// O upgrade para WebSocket e o long-polling são tratados pelo próprio
+// ReverseProxy; como a instância vem em todas as requisições, as sessões
+// de polling sempre caem no mesmo servidor.
+func HandleRealtimeProxy(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("instanceName") == "" {
+		http.Error(w, "Nome da instância não fornecido (use ?instanceName=)", http.StatusBadRequest)
+		return
+	}
+
+	proxyToInstanceServer(w, r, nil)
+}
+
+// instanceNameFromRequest extrai o nome da instância das rotas da Evolution,
+// que seguem o formato /{controller}/{action}/{instanceName}. Rotas sem esse
+// segmento (ex.: /instance/fetchInstances) podem informar ?instanceName=.
+func instanceNameFromRequest(r *http.Request) string {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) >= 3 && parts[2] != "" {
+		return parts[2]
+	}
+	return r.URL.Query().Get("instanceName")
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+)
+
+const (
+	defaultReconcileWorkers = 8
+	defaultReconcileTimeout = 20 * time.Second
+)
+
+// reconcileClient não tem timeout próprio: o limite vem do contexto de cada
+// servidor.
+var reconcileClient = &http.Client{}
+
+// ReconcileResult é o resultado da reconciliação de um servidor.
+type ReconcileResult struct {
+	ServerID   int    `json:"server_id"`
+	ServerName string `json:"server_name"`
+	DurationMs int64  `json:"duration_ms"`
+	Instances  int    `json:"instances"`
+	// Updated conta as instâncias cujo status mudou nesta rodada.
+	Updated int    `json:"updated"`
+	Error   string `json:"error,omitempty"`
+	// Skipped é o motivo de o servidor não ter sido consultado.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// ReconcileReport é o resultado de uma rodada completa.
+type ReconcileReport struct {
+	StartedAt  time.Time         `json:"started_at"`
+	DurationMs int64             `json:"duration_ms"`
+	Servers    []ReconcileResult `json:"servers"`
+	Drift      DriftReport       `json:"drift"`
+}
+
+// FetchInstances é a rodada de reconciliação executada a cada minuto pela
+// réplica líder: consulta todos os servidores e atualiza o status das
+// instâncias. ctx é cancelado se a liderança for perdida.
+func FetchInstances(ctx context.Context) {
+	fmt.Println("Start Cron")
+
+	report := Reconcile(ctx)
+	for _, result := range report.Servers {
+		if result.Skipped != "" {
+			continue
+		}
+		if result.Error != "" {
+			fmt.Printf("Reconciliação %s: erro em %dms: %s\n", result.ServerName, result.DurationMs, result.Error)
+			continue
+		}
+		fmt.Printf("Reconciliação %s: %d instâncias, %d atualizadas em %dms\n",
+			result.ServerName, result.Instances, result.Updated, result.DurationMs)
+	}
+	for _, drift := range report.Drift.Drifts {
+		fmt.Printf("Divergência %s: instância %s no servidor %d (reparo: %s %s)\n",
+			drift.Type, drift.InstanceName, drift.ServerID, drift.Repair, drift.RepairError)
+	}
+
+	fmt.Printf("End Cron %dms\n", report.DurationMs)
+}
+
+// Reconcile consulta os servidores em paralelo (RECONCILE_WORKERS por vez),
+// cada um com seu próprio timeout (RECONCILE_TIMEOUT_SECONDS), e atualiza o
+// status das instâncias encontradas. Um servidor lento não atrasa os demais.
+// Com as mesmas respostas, detecta as divergências entre o banco e os
+// servidores e aplica as políticas de reparo configuradas (ver repairDrift).
+func Reconcile(ctx context.Context) ReconcileReport {
+	report := ReconcileReport{StartedAt: time.Now()}
+
+	var servers []models.Server
+	if err := models.DB.Order("id").Find(&servers).Error; err != nil {
+		fmt.Println("Erro ao executar a consulta:", err)
+		return report
+	}
+
+	// As instâncias do banco são lidas antes e depois da consulta aos
+	// servidores; ver detectDrift.
+	before, err := loadInstances()
+	if err != nil {
+		fmt.Println("Erro ao executar a consulta:", err)
+		return report
+	}
+
+	skips, err := reconcileSkips()
+	if err != nil {
+		fmt.Println("Erro ao executar a consulta:", err)
+		return report
+	}
+
+	fetched := fetchFleet(ctx, servers, skips)
+
+	report.Servers = make([]ReconcileResult, len(servers))
+	for i, server := range servers {
+		report.Servers[i] = reconcileServer(server, fetched[i])
+	}
+
+	after, err := loadInstances()
+	if err != nil {
+		fmt.Println("Erro ao executar a consulta:", err)
+	} else {
+		report.Drift = detectDrift(servers, fetched, before, after)
+		repairDrift(ctx, servers, &report.Drift)
+	}
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+
+	if err := saveLastReconcile(report); err != nil {
+		fmt.Println("Erro ao salvar o relatório da reconciliação:", err)
+	}
+
+	return report
+}
+
+// saveLastReconcile grava o relatório no banco (ver models.ReconcileRun).
+func saveLastReconcile(report ReconcileReport) error {
+	content, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	return models.DB.Save(&models.ReconcileRun{
+		ID:        models.LastReconcileRunID,
+		StartedAt: report.StartedAt,
+		Report:    string(content),
+	}).Error
+}
+
+// serverFetch é a resposta de /instance/fetchInstances de um servidor.
+// Skipped é o motivo de o servidor não ter sido consultado.
+type serverFetch struct {
+	Instances []models.ServerInstance
+	Err       error
+	Duration  time.Duration
+	Skipped   string
+}
+
+// reconcileSkips retorna os servidores que ficam fora da reconciliação, com
+// o motivo (provision ou decommission): os que têm um job de
+// provisionamento em andamento. As instâncias deles mudam de servidor ou
+// ainda não existem, e a reconciliação desfaria o trabalho dos jobs.
+// Servidores apenas cordoned continuam atendendo as instâncias que têm e
+// são reconciliados normalmente.
+func reconcileSkips() (map[int]string, error) {
+	var jobs []models.ProvisioningJob
+	if err := models.DB.Where("server_id <> 0 AND state NOT IN ?", models.FinishedJobStates).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+
+	skips := map[int]string{}
+	for _, job := range jobs {
+		skips[job.ServerID] = job.Kind
+	}
+	return skips, nil
+}
+
+// fetchFleet consulta os servidores que não estão em skips em um pool de
+// RECONCILE_WORKERS, com RECONCILE_TIMEOUT_SECONDS por servidor. O
+// resultado segue a ordem de servers.
+func fetchFleet(ctx context.Context, servers []models.Server, skips map[int]string) []serverFetch {
+	fetched := make([]serverFetch, len(servers))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < reconcileWorkers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fetched[i] = fetchServer(ctx, servers[i])
+			}
+		}()
+	}
+
+	for i, server := range servers {
+		if reason, ok := skips[server.ID]; ok {
+			fetched[i] = serverFetch{Skipped: reason}
+			continue
+		}
+
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			fetched[i] = serverFetch{Err: ctx.Err()}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return fetched
+}
+
+func fetchServer(ctx context.Context, server models.Server) serverFetch {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, reconcileTimeout())
+	defer cancel()
+
+	instances, err := fetchServerInstances(ctx, server)
+	return serverFetch{Instances: instances, Err: err, Duration: time.Since(start)}
+}
+
+func reconcileServer(server models.Server, fetched serverFetch) ReconcileResult {
+	result := ReconcileResult{ServerID: server.ID, ServerName: server.Name, DurationMs: fetched.Duration.Milliseconds()}
+	if fetched.Skipped != "" {
+		result.Skipped = fetched.Skipped
+		return result
+	}
+	if fetched.Err != nil {
+		result.Error = fetched.Err.Error()
+		return result
+	}
+
+	result.Instances = len(fetched.Instances)
+	for _, instance := range fetched.Instances {
+		changed, err := observeInstanceStatus(server, instance.Instance)
+		if err != nil {
+			fmt.Println("Erro ao atualizar status da instância:", err)
+			continue
+		}
+		if changed {
+			result.Updated++
+		}
+	}
+
+	return result
+}
+
+// observeInstanceStatus aplica à instância do banco o status informado pela
+// Evolution (ver models.InstanceState.Observe). Só vale o status informado
+// pelo servidor registrado no banco: uma cópia em outro servidor (ex.: a que
+// ficou na origem de uma migração) não altera a linha. Instâncias que não
+// estão no banco, ou que estão em outro servidor, são tratadas por
+// detectDrift e ignoradas aqui.
+func observeInstanceStatus(server models.Server, reported models.InstanceByEvolution) (bool, error) {
+	if reported.ApiKey == "" {
+		return false, nil
+	}
+
+	var instances []models.Instance
+	if err := models.DB.Where("apikey = ? AND server_id = ?", reported.ApiKey, server.ID).Limit(1).Find(&instances).Error; err != nil {
+		return false, err
+	}
+	if len(instances) == 0 {
+		return false, nil
+	}
+
+	instance := instances[0]
+	return models.SetInstanceStatus(models.DB, &instance, instance.Status.Observe(reported.Status), models.StatusSourceCron)
+}
+
+func loadInstances() ([]models.Instance, error) {
+	var instances []models.Instance
+	err := models.DB.Order("id").Find(&instances).Error
+	return instances, err
+}
+
+// fetchServerInstances chama /instance/fetchInstances no servidor.
+func fetchServerInstances(ctx context.Context, server models.Server) ([]models.ServerInstance, error) {
+	raw, err := fetchServerInstancesRaw(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]models.ServerInstance, 0, len(raw))
+	for _, item := range raw {
+		var instance models.ServerInstance
+		if err := json.Unmarshal(item, &instance); err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// fetchServerInstancesRaw devolve a lista de /instance/fetchInstances sem
+// decodificar cada instância.
+func fetchServerInstancesRaw(ctx context.Context, server models.Server) ([]json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/instance/fetchInstances", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
+
+	resp, err := reconcileClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var instances []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// GetLastReconcile retorna o relatório da última rodada de reconciliação,
+// gravado no banco pela réplica líder.
+func GetLastReconcile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var runs []models.ReconcileRun
+	if err := models.DB.Where("id = ?", models.LastReconcileRunID).Limit(1).Find(&runs).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve reconcile report")
+		return
+	}
+	if len(runs) == 0 {
+		json.NewEncoder(w).Encode(ReconcileReport{})
+		return
+	}
+
+	w.Write([]byte(runs[0].Report))
+}
+
+func reconcileWorkers() int {
+	value, err := strconv.Atoi(os.Getenv("RECONCILE_WORKERS"))
+	if err != nil || value <= 0 {
+		return defaultReconcileWorkers
+	}
+	return value
+}
+
+func reconcileTimeout() time.Duration {
+	value, err := strconv.Atoi(os.Getenv("RECONCILE_TIMEOUT_SECONDS"))
+	if err != nil || value <= 0 {
+		return defaultReconcileTimeout
+	}
+	return time.Duration(value) * time.Second
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/placement"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/provisioning"
+	"github.com/go-playground/validator/v10"
+)
+
+// defaultMinFreeSlots é o mínimo de vagas livres na frota antes de um novo
+// servidor ser provisionado.
+const defaultMinFreeSlots = 10
+
+// instanceStore grava as reservas feitas na criação de instâncias. O padrão
+// usa o Postgres (ver placement.Reserve); os testes usam um em memória.
+type instanceStore interface {
+	// Reserve grava a instância em um servidor com vaga e retorna a
+	// instância gravada, a URL do servidor e as vagas livres restantes.
+	Reserve(input models.Instance) (models.Instance, string, int, error)
+	// Release desfaz uma reserva.
+	Release(instance models.Instance) error
+	// Created registra a criação na Evolution e leva a instância a next.
+	Created(instance models.Instance, next models.InstanceState) error
+}
+
+var store instanceStore = dbInstanceStore{}
+
+// enqueueProvisioning pede um novo servidor; trocado nos testes.
+var enqueueProvisioning = func() error {
+	_, err := provisioning.Enqueue()
+	return err
+}
+
+type dbInstanceStore struct{}
+
+func (dbInstanceStore) Reserve(input models.Instance) (models.Instance, string, int, error) {
+	return placement.Reserve(input)
+}
+
+func (dbInstanceStore) Release(instance models.Instance) error {
+	return models.DB.Delete(&instance).Error
+}
+
+func (dbInstanceStore) Created(instance models.Instance, next models.InstanceState) error {
+	if err := models.RecordInstanceCreated(models.DB, instance, models.StatusSourceCreate); err != nil {
+		return err
+	}
+	_, err := models.SetInstanceStatus(models.DB, &instance, next, models.StatusSourceCreate)
+	return err
+}
+
+// reserveInstance grava a instância em um servidor com vaga (ver
+// instanceStore.Reserve) e pede um novo servidor quando a frota fica com
+// poucas vagas livres. Retorna a instância gravada e a URL do servidor.
+func reserveInstance(input models.Instance) (models.Instance, string, error) {
+	if err := validator.New().Struct(input); err != nil {
+		return models.Instance{}, "", err
+	}
+
+	reserved, serverUrl, freeSlots, err := store.Reserve(input)
+	if err != nil && err != placement.ErrNoServerAvailable {
+		return models.Instance{}, "", err
+	}
+
+	if err == placement.ErrNoServerAvailable || freeSlots < minFreeSlots() {
+		provisionServer()
+	}
+
+	return reserved, serverUrl, err
+}
+
+// releaseInstance desfaz uma reserva feita por reserveInstance.
+func releaseInstance(instance models.Instance) {
+	if err := store.Release(instance); err != nil {
+		fmt.Println("Erro ao liberar a reserva da instância:", err)
+	}
+}
+
+// provisionServer pede um novo servidor. provisioning.Enqueue não cria um
+// segundo job enquanto houver um em andamento.
+func provisionServer() {
+	if err := enqueueProvisioning(); err != nil {
+		fmt.Println("Erro ao provisionar servidor:", err)
+	}
+}
+
+func minFreeSlots() int {
+	value, err := strconv.Atoi(os.Getenv("PROVISION_MIN_FREE_SLOTS"))
+	if err != nil || value < 0 {
+		return defaultMinFreeSlots
+	}
+	return value
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/swarm"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+	"github.com/gorilla/mux"
+)
+
+// defaultStacks são as stacks consultadas por GetServerStack quando nenhuma
+// é informada em ?stack=.
+var defaultStacks = []string{"evolution", "postgres"}
+
+// GetServerStack consulta o Swarm do servidor e retorna serviços, réplicas e
+// tasks das stacks da Evolution.
+func GetServerStack(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id := mux.Vars(r)["id"]
+	var server models.Server
+
+	if err := models.DB.Where("id = ?", id).First(&server).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	stacks := r.URL.Query()["stack"]
+	if len(stacks) == 0 {
+		stacks = defaultStacks
+	}
+
+	client, err := swarm.Connect(&server)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadGateway, "Failed to connect to server: "+err.Error())
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var statuses []swarm.StackStatus
+	for _, stack := range stacks {
+		status, err := client.Stack(ctx, stack)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadGateway, "Failed to retrieve stack status: "+err.Error())
+			return
+		}
+		statuses = append(statuses, status)
+	}
+
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// GetStackRevisions lista as revisões de stack gravadas para o servidor, da
+// mais recente para a mais antiga. Os arquivos vêm sem os segredos.
+func GetStackRevisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid server id")
+		return
+	}
+
+	var server models.Server
+	if err := models.DB.Where("id = ?", id).First(&server).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	revisions := []models.StackRevision{}
+	if err := models.DB.Where("server_id = ?", server.ID).Order("revision DESC").Find(&revisions).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve stack revisions")
+		return
+	}
+
+	json.NewEncoder(w).Encode(revisions)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/auth"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/webhooks"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type CreateSubscriptionModel struct {
+	URL          string   `json:"url" validate:"required,url"`
+	InstanceName string   `json:"instance_name" validate:"required_without=Tenant"`
+	Tenant       string   `json:"tenant" validate:"required_without=InstanceName"`
+	Events       []string `json:"events"`
+	// Secret é opcional; sem ele um secret aleatório é gerado.
+	Secret string `json:"secret"`
+}
+
+// CreatedSubscription é a resposta da criação, a única que traz o secret.
+type CreatedSubscription struct {
+	models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// CreateWebhookSubscription registra um webhook de cliente para uma
+// instância ou para todas as instâncias de um tenant. Um tenant só assina
+// as próprias instâncias: o tenant da assinatura é sempre o dele. A URL não
+// pode apontar para a rede interna (ver webhooks.ValidateURL).
+func CreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var input CreateSubscriptionModel
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	principal := auth.FromRequest(r)
+	if !principal.Admin {
+		if input.Tenant != "" && input.Tenant != principal.Tenant {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		input.Tenant = principal.Tenant
+	}
+
+	if err := validator.New().Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation Error")
+		return
+	}
+
+	if input.InstanceName != "" {
+		var instances []models.Instance
+		if err := models.DB.Where("name = ?", input.InstanceName).Limit(1).Find(&instances).Error; err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve instance")
+			return
+		}
+		if !principal.Admin && (len(instances) == 0 || instances[0].Tenant != principal.Tenant) {
+			utils.RespondWithError(w, http.StatusNotFound, "instance not found")
+			return
+		}
+	}
+
+	if err := webhooks.ValidateURL(r.Context(), input.URL); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid webhook URL: "+err.Error())
+		return
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to generate secret")
+			return
+		}
+		secret = hex.EncodeToString(random)
+	}
+
+	var events []string
+	for _, event := range input.Events {
+		if event = normalizeEvent(strings.TrimSpace(event)); event != "" {
+			events = append(events, event)
+		}
+	}
+
+	subscription := models.WebhookSubscription{
+		URL:          input.URL,
+		InstanceName: input.InstanceName,
+		Tenant:       input.Tenant,
+		Events:       strings.Join(events, ","),
+		Secret:       secret,
+	}
+	if err := models.DB.Create(&subscription).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create subscription")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedSubscription{WebhookSubscription: subscription, Secret: secret})
+}
+
+// GetAllWebhookSubscriptions lista as assinaturas, filtrando por
+// ?instance_name= e ?tenant=. Um tenant só vê as próprias.
+func GetAllWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	query := models.DB.Order("id")
+	if name := r.URL.Query().Get("instance_name"); name != "" {
+		query = query.Where("instance_name = ?", name)
+	}
+	if principal := auth.FromRequest(r); !principal.Admin {
+		query = query.Where("tenant = ?", principal.Tenant)
+	} else if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+		query = query.Where("tenant = ?", tenant)
+	}
+
+	var subscriptions []models.WebhookSubscription
+	if err := query.Find(&subscriptions).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve subscriptions")
+		return
+	}
+
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+func GetWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	subscription, ok := findSubscription(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// DeleteWebhookSubscription remove a assinatura. O log de entregas é
+// mantido; entregas pendentes falham na próxima tentativa.
+func DeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	subscription, ok := findSubscription(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	if err := models.DB.Delete(&subscription).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete subscription")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries retorna o log de entregas da assinatura, das mais
+// recentes para as mais antigas, filtrando por ?state=.
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	subscription, ok := findSubscription(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	query := models.DB.Where("subscription_id = ?", subscription.ID).Order("id DESC").Limit(defaultHistoryLimit)
+	if state := r.URL.Query().Get("state"); state != "" {
+		query = query.Where("state = ?", state)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve deliveries")
+		return
+	}
+
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	delivery, ok := findDelivery(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// ReplayWebhookDelivery reenvia uma entrega com o mesmo payload.
+func ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid delivery id")
+		return
+	}
+
+	if _, ok := findDelivery(w, r, strconv.Itoa(id)); !ok {
+		return
+	}
+
+	replay, err := webhooks.Replay(id)
+	if err == gorm.ErrRecordNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, "Delivery not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to replay delivery")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(replay)
+}
+
+// findSubscription carrega a assinatura se quem chama pode vê-la; senão
+// responde 404, sem revelar que ela existe.
+func findSubscription(w http.ResponseWriter, r *http.Request, id string) (models.WebhookSubscription, bool) {
+	var subscription models.WebhookSubscription
+
+	if err := models.DB.Where("id = ?", id).First(&subscription).Error; err != nil ||
+		!auth.FromRequest(r).CanAccessTenant(subscription.Tenant) {
+		utils.RespondWithError(w, http.StatusNotFound, "Subscription not found")
+		return subscription, false
+	}
+
+	return subscription, true
+}
+
+// findDelivery carrega a entrega se quem chama pode ver a assinatura dela.
+// Entregas de assinaturas removidas só são visíveis ao administrador.
+func findDelivery(w http.ResponseWriter, r *http.Request, id string) (models.WebhookDelivery, bool) {
+	var delivery models.WebhookDelivery
+
+	if err := models.DB.Where("id = ?", id).First(&delivery).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Delivery not found")
+		return delivery, false
+	}
+
+	principal := auth.FromRequest(r)
+	if principal.Admin {
+		return delivery, true
+	}
+
+	var subscription models.WebhookSubscription
+	if err := models.DB.Where("id = ?", delivery.SubscriptionID).First(&subscription).Error; err != nil ||
+		!principal.CanAccessTenant(subscription.Tenant) {
+		utils.RespondWithError(w, http.StatusNotFound, "Delivery not found")
+		return delivery, false
+	}
+
+	return delivery, true
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type CreateTenantModel struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// CreatedTenant é a resposta da criação, a única que traz a chave.
+type CreatedTenant struct {
+	models.Tenant
+	Key string `json:"key"`
+}
+
+// CreateTenant cadastra um tenant e devolve a chave que ele usa no header
+// apikey.
+func CreateTenant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var input CreateTenantModel
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := validator.New().Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation Error")
+		return
+	}
+
+	tenant := models.Tenant{Name: input.Name}
+	key, err := models.CreateTenant(models.DB, &tenant)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create tenant")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedTenant{Tenant: tenant, Key: key})
+}
+
+func GetAllTenants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var tenants []models.Tenant
+	if err := models.DB.Order("id").Find(&tenants).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve tenants")
+		return
+	}
+
+	json.NewEncoder(w).Encode(tenants)
+}
+
+// DeleteTenant remove o tenant, revogando a chave. As instâncias dele
+// continuam acessíveis pelo token de cada uma.
+func DeleteTenant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id := mux.Vars(r)["id"]
+	var tenant models.Tenant
+
+	if err := models.DB.Where("id = ?", id).First(&tenant).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Tenant not found")
+		return
+	}
+
+	if err := models.DB.Delete(&tenant).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete tenant")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/provisioning"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type CreateUpgradeModel struct {
+	Image string `json:"image" validate:"required"`
+}
+
+// CreateFleetUpgrade inicia a troca da imagem da Evolution API em todos os
+// servidores, um por vez.
+func CreateFleetUpgrade(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var input CreateUpgradeModel
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := validator.New().Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation Error")
+		return
+	}
+
+	upgrade, err := provisioning.StartUpgrade(input.Image)
+	if err == provisioning.ErrUpgradeInProgress {
+		utils.RespondWithError(w, http.StatusConflict, "An upgrade is already in progress")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to start upgrade")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(upgrade)
+}
+
+// CreateFleetRedeploy reimplanta a stack da Evolution em todos os servidores
+// mantendo a imagem de cada um, para levar a eles o ambiente atual. É o
+// caminho para os servidores cadastrados antes do webhook global receberem
+// o token e o WEBHOOK_GLOBAL_URL. Roda como um upgrade sem imagem.
+func CreateFleetRedeploy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	upgrade, err := provisioning.StartUpgrade("")
+	if err == provisioning.ErrUpgradeInProgress {
+		utils.RespondWithError(w, http.StatusConflict, "An upgrade is already in progress")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to start redeploy")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(upgrade)
+}
+
+func GetAllFleetUpgrades(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var upgrades []models.FleetUpgrade
+	if err := models.DB.Order("id DESC").Find(&upgrades).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve upgrades")
+		return
+	}
+
+	json.NewEncoder(w).Encode(upgrades)
+}
+
+func GetFleetUpgrade(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id := mux.Vars(r)["id"]
+	var upgrade models.FleetUpgrade
+
+	if err := models.DB.Where("id = ?", id).First(&upgrade).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Upgrade not found")
+		return
+	}
+
+	json.NewEncoder(w).Encode(upgrade)
+}
+
+// ResumeFleetUpgrade retoma um upgrade pausado, tentando de novo o servidor
+// que falhou.
+func ResumeFleetUpgrade(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid upgrade id")
+		return
+	}
+
+	upgrade, err := provisioning.ResumeUpgrade(id)
+	if err == gorm.ErrRecordNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, "Upgrade not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(upgrade)
+}
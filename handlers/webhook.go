@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/utils"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// Eventos da Evolution tratados pelo webhook, já normalizados (ver
+// normalizeEvent).
+const (
+	EventConnectionUpdate = "connection.update"
+	EventQRCodeUpdated    = "qrcode.updated"
+	EventLogoutInstance   = "logout.instance"
+	EventMessagesUpsert   = "messages.upsert"
+)
+
+// maxWebhookBody limita o corpo dos eventos; messages.upsert pode trazer
+// mídia em base64.
+const maxWebhookBody = 16 << 20
+
+// loggedOutReason é o statusReason do connection.update quando a sessão foi
+// encerrada pelo celular.
+const loggedOutReason = 401
+
+type connectionUpdate struct {
+	State        string `json:"state"`
+	StatusReason int    `json:"statusReason"`
+}
+
+// HandleEvolutionWebhook recebe os eventos do webhook global das Evolution
+// (POST /webhooks/evolution/{token}). O token identifica o servidor que
+// enviou (models.Server.WebhookToken) e só instâncias registradas nesse
+// servidor são atualizadas; os eventos delas também são repassados às
+// assinaturas de webhook dos clientes (ver webhooks.Dispatch). O status muda
+// na hora; o cron de reconciliação continua como rede de segurança para
+// eventos perdidos.
+func HandleEvolutionWebhook(w http.ResponseWriter, r *http.Request) {
+	server, ok := webhookServer(mux.Vars(r)["token"])
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "invalid webhook token")
+		return
+	}
+
+	var event models.EvolutionEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&event); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	event.Event = normalizeEvent(event.Event)
+
+	// Erros daqui em diante são apenas registrados: responder com erro faria
+	// a Evolution reenviar um evento que não vai ser aceito de novo.
+	if err := applyEvolutionEvent(server, event); err != nil {
+		fmt.Printf("Erro ao processar evento %s da instância %s (%s): %s\n", event.Event, event.Instance, server.Name, err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func webhookServer(token string) (models.Server, bool) {
+	var server models.Server
+	if token == "" {
+		return server, false
+	}
+	if err := models.DB.Where("webhook_token = ?", token).First(&server).Error; err != nil {
+		return server, false
+	}
+	return server, true
+}
+
+// applyEvolutionEvent atualiza o estado da instância conforme o evento e
+// repassa o evento para as assinaturas de webhook dos clientes.
+func applyEvolutionEvent(server models.Server, event models.EvolutionEvent) error {
+	var instance models.Instance
+	err := models.DB.Where("name = ? AND server_id = ?", event.Instance, server.ID).First(&instance).Error
+	if err != nil {
+		return fmt.Errorf("instância não registrada neste servidor: %w", err)
+	}
+
+	if err := webhooks.Dispatch(instance, event); err != nil {
+		fmt.Println("Erro ao repassar evento para os webhooks:", err)
+	}
+
+	switch event.Event {
+	case EventConnectionUpdate, EventQRCodeUpdated, EventLogoutInstance, EventMessagesUpsert:
+	default:
+		return nil
+	}
+
+	state, err := eventState(instance, event)
+	if err != nil {
+		return err
+	}
+
+	_, err = models.SetInstanceStatus(models.DB, &instance, state, models.StatusSourceWebhook)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		fmt.Printf("Status da instância %s mantido (%s): %s\n", instance.Name, models.StatusSourceWebhook, err)
+		return nil
+	}
+	return err
+}
+
+// eventState retorna o estado para o qual o evento leva a instância.
+func eventState(instance models.Instance, event models.EvolutionEvent) (models.InstanceState, error) {
+	switch event.Event {
+	case EventConnectionUpdate:
+		var update connectionUpdate
+		if err := json.Unmarshal(event.Data, &update); err != nil {
+			return "", err
+		}
+		if update.State == "close" && update.StatusReason == loggedOutReason {
+			return models.StateLoggedOut, nil
+		}
+		return instance.Status.Observe(update.State), nil
+	case EventQRCodeUpdated:
+		return models.StateQRPending, nil
+	case EventLogoutInstance:
+		return models.StateLoggedOut, nil
+	default:
+		// messages.upsert: a instância só recebe mensagens conectada.
+		return instance.Status.Observe("open"), nil
+	}
+}
+
+// normalizeEvent converte o nome do evento para o formato com ponto
+// (CONNECTION_UPDATE -> connection.update); a Evolution usa os dois.
+func normalizeEvent(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "_", ".")
+}
@@ -0,0 +1,158 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// lockKey identifica o advisory lock do Postgres disputado pelas réplicas.
+const lockKey = 0x77736d03
+
+const (
+	// retryInterval é o intervalo entre as tentativas de virar líder.
+	retryInterval = 10 * time.Second
+	// checkInterval é o intervalo em que o líder confirma que a conexão que
+	// segura o lock continua viva.
+	checkInterval = 5 * time.Second
+	checkTimeout  = 5 * time.Second
+)
+
+// heldQuery confirma que a sessão ainda segura o advisory lock.
+const heldQuery = `SELECT EXISTS (
+	SELECT 1 FROM pg_locks
+	WHERE locktype = 'advisory' AND classid = 0 AND objid::bigint = $1 AND objsubid = 1
+		AND pid = pg_backend_pid() AND granted
+)`
+
+// ErrNotLeader indica que esta réplica não é (ou deixou de ser) a líder.
+var ErrNotLeader = errors.New("esta réplica não é a líder")
+
+// session é a conexão que segura o lock enquanto esta réplica é a líder, e
+// o cancelamento do contexto passado a fn. pgx.Conn não pode ser usada por
+// duas goroutines ao mesmo tempo, daí o mutex.
+var session struct {
+	sync.Mutex
+	conn   *pgx.Conn
+	cancel context.CancelFunc
+}
+
+// Run disputa a liderança até ctx ser cancelado. A réplica que obtém o
+// advisory lock (em uma conexão dedicada, fora do pool do gorm) executa fn;
+// o contexto passado a fn é cancelado quando a liderança é perdida, e o lock
+// só é devolvido depois de fn retornar. Se a conexão cair o Postgres libera o
+// lock na hora, mas a verificação periódica só percebe em até
+// checkInterval; por isso os workers chamam Fence antes de cada etapa que
+// altera jobs, e uma réplica que perdeu o lock para antes de gravar.
+func Run(ctx context.Context, fn func(ctx context.Context)) {
+	for {
+		err := lead(ctx, fn)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			fmt.Println("Erro na eleição de líder:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// lead tenta obter o lock e, se conseguir, executa fn enquanto a conexão
+// estiver viva. Retorna nil sem executar fn se outra réplica é a líder.
+func lead(ctx context.Context, fn func(ctx context.Context)) error {
+	conn, err := pgx.Connect(ctx, models.DSN())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&acquired); err != nil {
+		return err
+	}
+	if !acquired {
+		return nil
+	}
+
+	fmt.Println("Esta réplica é a líder")
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	session.Lock()
+	session.conn, session.cancel = conn, cancel
+	session.Unlock()
+	defer func() {
+		session.Lock()
+		session.conn, session.cancel = nil, nil
+		session.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(leaderCtx)
+	}()
+
+	err = watch(leaderCtx)
+	cancel()
+	<-done
+
+	fmt.Println("Liderança encerrada")
+	return err
+}
+
+// watch verifica periodicamente que o lock continua com esta réplica.
+// Retorna quando ctx é cancelado ou o lock é perdido.
+func watch(ctx context.Context) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if err := Fence(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+}
+
+// Fence confirma, na conexão que segura o lock, que esta réplica ainda é a
+// líder. Os workers chamam Fence antes de cada etapa que altera o estado de
+// um job e antes de gravá-lo: assim uma réplica que perdeu o lock não grava
+// por cima da nova líder, mesmo antes de a verificação periódica perceber.
+// Se o lock foi perdido a liderança é encerrada e o erro é retornado.
+func Fence(ctx context.Context) error {
+	session.Lock()
+	defer session.Unlock()
+
+	if session.conn == nil {
+		return ErrNotLeader
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	var held bool
+	err := session.conn.QueryRow(checkCtx, heldQuery, int64(lockKey)).Scan(&held)
+	if err == nil && !held {
+		err = ErrNotLeader
+	}
+	if err != nil {
+		session.cancel()
+		return fmt.Errorf("lock de liderança perdido: %w", err)
+	}
+	return nil
+}
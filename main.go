@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/controllers"
 	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/handlers"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/leader"
 	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/provisioning"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/scheduler"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/stacks"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/webhooks"
 	"github.com/joho/godotenv"
-	"gopkg.in/robfig/cron.v2"
 )
 
 func main() {
@@ -30,12 +37,14 @@ func main() {
 		fmt.Println("Erro ao conectar ao banco de dados:", err)
 		return
 	}
+	if err := stacks.RedactRevisions(models.DB); err != nil {
+		fmt.Println("Erro ao remover os segredos das revisões de stack:", err)
+		return
+	}
 
-	c := cron.New()
-	c.AddFunc("* * * * *", func() {
-		go handlers.FetchInstances()
-	})
-	c.Start()
+	// As tarefas de fundo rodam só na réplica líder; as demais apenas
+	// atendem HTTP.
+	go leader.Run(context.Background(), runBackground)
 
 	// Iniciar o servidor HTTP
 	err = server.ListenAndServe()
@@ -44,3 +53,23 @@ func main() {
 		return
 	}
 }
+
+// runBackground executa os workers e a reconciliação até ctx ser cancelado.
+func runBackground(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, run := range []func(context.Context){
+		provisioning.Run,
+		provisioning.RunUpgrades,
+		webhooks.Run,
+		func(ctx context.Context) {
+			scheduler.Every(ctx, "reconcile", time.Minute, handlers.FetchInstances)
+		},
+	} {
+		wg.Add(1)
+		go func(run func(context.Context)) {
+			defer wg.Done()
+			run(ctx)
+		}(run)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/events"
+	"gorm.io/gorm"
+)
+
+// Origens de uma mudança de status de instância.
+const (
+	StatusSourceCreate  = "create"
+	StatusSourceImport  = "import"
+	StatusSourceCron    = "cron"
+	StatusSourceConnect = "connect"
+	StatusSourceLogout  = "logout"
+	StatusSourceRestart = "restart"
+	StatusSourceDelete  = "delete"
+	StatusSourceMigrate = "migrate"
+	StatusSourceWebhook = "webhook"
+	StatusSourceAPI     = "api"
+)
+
+// InstanceStatusChange é uma transição de status de uma instância. O
+// histórico é mantido mesmo depois de a instância ser apagada.
+type InstanceStatusChange struct {
+	ID           int           `gorm:"primary_key" json:"id"`
+	InstanceID   int           `gorm:"index:idx_instance_status_changes_instance_created" json:"instance_id"`
+	InstanceName string        `json:"instance_name"`
+	From         InstanceState `gorm:"column:from_status" json:"from"`
+	To           InstanceState `gorm:"column:to_status" json:"to"`
+	Source       string        `json:"source"`
+	CreatedAt    time.Time     `gorm:"index:idx_instance_status_changes_instance_created" json:"created_at"`
+}
+
+// statusRetries é quantas vezes SetInstanceStatus relê a linha quando outro
+// escritor mudou o status entre a leitura e a gravação.
+const statusRetries = 3
+
+// errStatusChanged indica que o status gravado não era mais o lido.
+var errStatusChanged = errors.New("status da instância mudou durante a atualização")
+
+// SetInstanceStatus leva a instância ao novo estado, atualiza UpdatedAt e
+// registra a transição no histórico, na mesma transação. Transições não
+// permitidas pela máquina de estados retornam ErrInvalidTransition. Se o
+// estado não mudou nada é gravado e changed é false.
+//
+// A gravação só acontece se o status no banco ainda for instance.Status
+// (compare-and-set). Se outro escritor (webhook, cron, proxy) mudou a linha
+// antes, ela é relida e a transição verificada de novo a partir do status
+// atual, que também é o From registrado no histórico.
+func SetInstanceStatus(db *gorm.DB, instance *Instance, status InstanceState, source string) (changed bool, err error) {
+	for attempt := 0; ; attempt++ {
+		changed, err = compareAndSetStatus(db, instance, status, source)
+		if err != errStatusChanged {
+			return changed, err
+		}
+		if attempt+1 == statusRetries {
+			return false, err
+		}
+
+		var current Instance
+		if err := db.Select("status").Where("id = ?", instance.ID).First(&current).Error; err != nil {
+			return false, err
+		}
+		instance.Status = current.Status
+	}
+}
+
+func compareAndSetStatus(db *gorm.DB, instance *Instance, status InstanceState, source string) (bool, error) {
+	if instance.Status == status {
+		return false, nil
+	}
+	if err := checkTransition(instance.Status, status); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	change := InstanceStatusChange{
+		InstanceID:   instance.ID,
+		InstanceName: instance.Name,
+		From:         instance.Status,
+		To:           status,
+		Source:       source,
+		CreatedAt:    now,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Instance{}).Where("id = ? AND status = ?", instance.ID, instance.Status).
+			Updates(map[string]interface{}{"status": status, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStatusChanged
+		}
+		return tx.Create(&change).Error
+	})
+	if err != nil {
+		return false, err
+	}
+
+	instance.Status = status
+	instance.UpdatedAt = &now
+	publishChange(change, *instance)
+	return true, nil
+}
+
+// RecordInstanceCreated registra o status inicial de uma instância recém
+// gravada.
+func RecordInstanceCreated(db *gorm.DB, instance Instance, source string) error {
+	change := InstanceStatusChange{
+		InstanceID:   instance.ID,
+		InstanceName: instance.Name,
+		To:           instance.Status,
+		Source:       source,
+		CreatedAt:    time.Now(),
+	}
+	if err := db.Create(&change).Error; err != nil {
+		return err
+	}
+
+	publishChange(change, instance)
+	return nil
+}
+
+// publishChange avisa os assinantes do bus de eventos (ex.: GET /events)
+// sobre uma transição já gravada.
+func publishChange(change InstanceStatusChange, instance Instance) {
+	events.Publish(events.Event{
+		ID:           change.ID,
+		Type:         events.TypeStatus,
+		InstanceID:   change.InstanceID,
+		InstanceName: change.InstanceName,
+		ServerID:     instance.ServerID,
+		Tenant:       instance.Tenant,
+		From:         string(change.From),
+		To:           string(change.To),
+		Source:       change.Source,
+		At:           change.CreatedAt,
+	})
+}
@@ -1,15 +1,21 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Instance struct {
-	ID        int        `gorm:"primary_key" json:"id"`
-	Name      string     `gorm:"column:name" json:"name"`
-	Status    string     `gorm:"column:status" json:"status"`
-	ServerID  int        `gorm:"column:server_id" json:"server_id"`
-	Server    Server     `gorm:"foreignkey:ServerID" json:"server"`
-	UpdatedAt *time.Time `gorm:"column:updated_at" json:"updated_at"`
-	Apikey    string     `gorm:"uniqueIndex"`
+	ID        int           `gorm:"primary_key" json:"id"`
+	Name      string        `gorm:"column:name" json:"name"`
+	Status    InstanceState `gorm:"column:status" json:"status"`
+	ServerID  int           `gorm:"column:server_id" json:"server_id"`
+	Server    Server        `gorm:"foreignkey:ServerID" json:"server"`
+	UpdatedAt *time.Time    `gorm:"column:updated_at" json:"updated_at"`
+	Apikey    string        `gorm:"uniqueIndex"`
+	// Tenant é o cliente dono da instância: o tenant autenticado na criação
+	// (ou o header X-Tenant-ID, quando quem cria é o administrador).
+	Tenant string `gorm:"index" json:"tenant"`
 }
 
 type InstanceRequest struct {
@@ -22,6 +28,9 @@ type Result struct {
 	URL       string
 	CountOpen int
 	ID        int
+	Capacity  int
+	Weight    int
+	Cordoned  bool
 }
 
 var UrlServer struct {
@@ -38,3 +47,12 @@ type InstanceByEvolution struct {
 type ServerInstance struct {
 	Instance InstanceByEvolution `json:"instance"`
 }
+
+// EvolutionEvent é um evento enviado pelo webhook global da Evolution.
+type EvolutionEvent struct {
+	Event     string          `json:"event"`
+	Instance  string          `json:"instance"`
+	Data      json.RawMessage `json:"data"`
+	DateTime  string          `json:"date_time"`
+	ServerURL string          `json:"server_url"`
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// Tipos de ProvisioningJob.
+const (
+	JobKindProvision    = "provision"
+	JobKindDecommission = "decommission"
+)
+
+// Estados de um job de provision, na ordem em que acontecem.
+const (
+	JobRequested  = "requested"
+	JobVMCreated  = "vm_created"
+	JobDNSCreated = "dns_created"
+	JobDeploying  = "deploying"
+	JobReady      = "ready"
+	JobFailed     = "failed"
+)
+
+// Estados de um job de decommission, depois de JobRequested.
+const (
+	JobCordoned   = "cordoned"
+	JobDrained    = "drained"
+	JobVMDeleted  = "vm_deleted"
+	JobDNSDeleted = "dns_deleted"
+	JobDone       = "done"
+)
+
+// ProvisioningJob acompanha a criação (provision) ou a remoção
+// (decommission) de um servidor. Cada etapa concluída é gravada antes da
+// próxima começar, para que o worker retome o job do ponto em que parou caso
+// o processo reinicie.
+type ProvisioningJob struct {
+	ID    int    `gorm:"primary_key" json:"id"`
+	Kind  string `gorm:"default:provision;index" json:"kind"`
+	State string `gorm:"index" json:"state"`
+	// Migrate faz o decommission mover as instâncias para outros servidores
+	// em vez de esperar que sejam removidas.
+	Migrate    bool   `json:"migrate"`
+	ServerName string `json:"server_name"`
+	Provider   string `json:"provider"`
+	ProviderID string `json:"provider_id"`
+	// ActionID é a ação do provedor que cria a máquina (ver
+	// providers.Action).
+	ActionID  string    `json:"action_id"`
+	IP        string    `json:"ip"`
+	ServerID  int       `json:"server_id"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FinishedJobStates são os estados em que um job não avança mais.
+var FinishedJobStates = []string{JobReady, JobDone, JobFailed}
+
+// Finished indica se o job chegou a um estado final.
+func (j ProvisioningJob) Finished() bool {
+	for _, state := range FinishedJobStates {
+		if j.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+// ProvisioningLog guarda a saída de uma etapa executada no servidor durante
+// um job.
+type ProvisioningLog struct {
+	ID         int       `gorm:"primary_key" json:"id"`
+	JobID      int       `gorm:"index" json:"job_id"`
+	Step       string    `json:"step"`
+	Command    string    `json:"command"`
+	Output     string    `json:"output"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
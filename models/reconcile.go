@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ReconcileRun guarda o relatório da última rodada de reconciliação, em
+// JSON, para que qualquer réplica possa servi-lo (só a líder roda o cron).
+// A tabela tem uma única linha, de ID 1.
+type ReconcileRun struct {
+	ID        int       `gorm:"primary_key" json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	Report    string    `gorm:"type:jsonb" json:"-"`
+}
+
+// LastReconcileRunID é o ID da linha de ReconcileRun.
+const LastReconcileRunID = 1
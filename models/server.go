@@ -1,6 +1,12 @@
 package models
 
-import "time"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Server struct {
 	ID        int       `gorm:"primary_key" json:"id"`
@@ -8,44 +14,44 @@ type Server struct {
 	IP        string    `json:"ip"`
 	CreatedAt time.Time `json:"created_at"`
 	URL       string    `json:"url"`
-}
-
-type RequestServerHetzner struct {
-	Firewalls        []Firewall `json:"firewalls"`
-	Image            string     `json:"image"`
-	Name             string     `json:"name"`
-	ServerType       string     `json:"server_type"`
-	SSHKeys          []int      `json:"ssh_keys"`
-	StartAfterCreate bool       `json:"start_after_create"`
-}
-
-type Firewall struct {
-	Firewall int `json:"firewall"`
-}
-
-type ResponseServerHetzner struct {
-	Server ServerHetzner `json:"server"`
-}
-
-type ServerHetzner struct {
-	PublicNet PublicNet `json:"public_net"`
-	Name      string    `json:"name"`
-}
-
-type PublicNet struct {
-	IPv4 IPv4 `json:"ipv4"`
-}
-
-type IPv4 struct {
-	IP      string `json:"ip"`
-	DNSPtr  string `json:"dns_ptr"`
-	Blocked bool   `json:"blocked"`
-}
-
-type DNSRecord struct {
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Content string `json:"content"`
-	TTL     int    `json:"ttl,omitempty"`
-	Proxied bool   `json:"proxied,omitempty"`
+	// Capacity é o máximo de instâncias ocupando vaga (ver SlotStates) que o
+	// servidor aceita.
+	Capacity int `gorm:"default:20" json:"capacity"`
+	// Weight é o peso do servidor no placement weighted-round-robin.
+	Weight int `gorm:"default:1" json:"weight"`
+	// Cordoned tira o servidor do placement sem afetar as instâncias que ele já tem.
+	Cordoned bool `gorm:"default:false" json:"cordoned"`
+	// Provider e ProviderID identificam a máquina no provedor de nuvem.
+	Provider   string `json:"provider"`
+	ProviderID string `json:"provider_id"`
+	// DNSRecordID é o id do registro A do servidor no provedor de DNS.
+	DNSRecordID string `json:"dns_record_id"`
+	// SSHHostKey é a chave de host gravada na primeira conexão SSH
+	// (formato authorized_keys); conexões seguintes exigem a mesma chave.
+	SSHHostKey string `json:"ssh_host_key"`
+	// StackRevisionID é a StackRevision implantada por último no servidor.
+	StackRevisionID int `json:"stack_revision_id"`
+	// EvolutionImage e EvolutionVersion são a imagem implantada e a versão
+	// reportada pela Evolution API após o último deploy ou upgrade.
+	EvolutionImage   string `json:"evolution_image"`
+	EvolutionVersion string `json:"evolution_version"`
+	// WebhookToken autentica os eventos que a Evolution do servidor envia
+	// ao manager; vai no caminho do WEBHOOK_GLOBAL_URL.
+	WebhookToken string `gorm:"index" json:"-"`
+}
+
+// EnsureWebhookToken gera e grava o WebhookToken do servidor, se ele ainda
+// não tiver um.
+func EnsureWebhookToken(db *gorm.DB, server *Server) error {
+	if server.WebhookToken != "" {
+		return nil
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+
+	server.WebhookToken = hex.EncodeToString(token)
+	return db.Model(server).Update("webhook_token", server.WebhookToken).Error
 }
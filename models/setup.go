@@ -11,8 +11,9 @@ import (
 
 var DB *gorm.DB
 
-func ConnectDatabase() error {
-	dsn := fmt.Sprintf(
+// DSN monta a conexão com o Postgres a partir das variáveis POSTGRES_*.
+func DSN() string {
+	return fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
 		os.Getenv("POSTGRES_HOST"),
 		os.Getenv("POSTGRES_USER"),
@@ -20,15 +21,30 @@ func ConnectDatabase() error {
 		os.Getenv("POSTGRES_DB"),
 		os.Getenv("POSTGRES_PORT"),
 	)
+}
+
+// Migrate cria ou atualiza as tabelas e converte os dados antigos.
+func Migrate(database *gorm.DB) error {
+	err := database.AutoMigrate(&Server{}, &Instance{}, &ProvisioningJob{}, &ProvisioningLog{}, &StackRevision{}, &FleetUpgrade{}, &InstanceStatusChange{}, &WebhookSubscription{}, &WebhookDelivery{}, &Tenant{}, &ReconcileRun{})
+	if err != nil {
+		return fmt.Errorf("failed to auto migrate tables: %w", err)
+	}
+	if err := migrateInstanceStates(database); err != nil {
+		return fmt.Errorf("failed to migrate instance states: %w", err)
+	}
+	return nil
+}
+
+func ConnectDatabase() error {
+	dsn := DSN()
 	fmt.Print("aqui", dsn)
 	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	err = database.AutoMigrate(&Server{}, &Instance{})
-	if err != nil {
-		return fmt.Errorf("failed to auto migrate tables: %w", err)
+	if err := Migrate(database); err != nil {
+		return err
 	}
 	var hasServer = true
 	var servers Server
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// StackRevision é o conjunto de arquivos de stack renderizado para um
+// servidor. Uma nova revisão só é criada quando o conteúdo muda.
+type StackRevision struct {
+	ID             int    `gorm:"primary_key" json:"id"`
+	ServerID       int    `gorm:"index" json:"server_id"`
+	Revision       int    `json:"revision"`
+	Hash           string `json:"hash"`
+	EvolutionImage string `json:"evolution_image"`
+	// Params são os parâmetros usados na renderização, sem a API key.
+	Params string `json:"params"`
+	// Files é a lista de stacks.File em JSON, sem a API key e sem o token
+	// do webhook.
+	Files     string    `json:"files"`
+	CreatedAt time.Time `json:"created_at"`
+}
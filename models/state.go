@@ -0,0 +1,128 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// InstanceState é o estado do ciclo de vida de uma instância.
+type InstanceState string
+
+const (
+	// StateCreating é a vaga reservada enquanto a Evolution cria a instância.
+	StateCreating InstanceState = "creating"
+	// StateQRPending aguarda a leitura do QR code.
+	StateQRPending InstanceState = "qr_pending"
+	// StateConnecting está conectando ao WhatsApp.
+	StateConnecting InstanceState = "connecting"
+	// StateOpen está conectada.
+	StateOpen InstanceState = "open"
+	// StateClosed está desconectada, mas com a sessão preservada.
+	StateClosed InstanceState = "closed"
+	// StateLoggedOut perdeu a sessão e precisa ler o QR code de novo.
+	StateLoggedOut InstanceState = "logged_out"
+	// StateDeleted foi apagada da Evolution. É um estado final.
+	StateDeleted InstanceState = "deleted"
+	// StateError indica que o estado real é desconhecido (ex.: status
+	// inesperado da Evolution).
+	StateError InstanceState = "error"
+)
+
+// ErrInvalidTransition indica uma transição não permitida pela máquina de
+// estados.
+var ErrInvalidTransition = errors.New("transição de estado inválida")
+
+// transitions são as transições permitidas a partir de cada estado.
+// Permanecer no mesmo estado é sempre permitido (e não gera histórico).
+var transitions = map[InstanceState][]InstanceState{
+	StateCreating:   {StateQRPending, StateConnecting, StateOpen, StateClosed, StateError, StateDeleted},
+	StateQRPending:  {StateConnecting, StateOpen, StateClosed, StateLoggedOut, StateError, StateDeleted},
+	StateConnecting: {StateQRPending, StateOpen, StateClosed, StateLoggedOut, StateError, StateDeleted},
+	StateOpen:       {StateConnecting, StateClosed, StateLoggedOut, StateError, StateDeleted},
+	StateClosed:     {StateQRPending, StateConnecting, StateOpen, StateLoggedOut, StateError, StateDeleted},
+	StateLoggedOut:  {StateQRPending, StateConnecting, StateOpen, StateError, StateDeleted},
+	StateError:      {StateQRPending, StateConnecting, StateOpen, StateClosed, StateLoggedOut, StateDeleted},
+	StateDeleted:    {},
+}
+
+// SlotStates são os estados em que a instância existe no servidor e ocupa
+// uma vaga; é o que o placement conta.
+var SlotStates = []InstanceState{
+	StateCreating, StateQRPending, StateConnecting, StateOpen, StateClosed, StateLoggedOut, StateError,
+}
+
+// Valid informa se o estado é conhecido.
+func (s InstanceState) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// CanTransition informa se a instância pode passar de s para to.
+func (s InstanceState) CanTransition(to InstanceState) bool {
+	if s == to {
+		return true
+	}
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTransition retorna ErrInvalidTransition se a transição não for
+// permitida. Estados antigos (gravados antes da máquina de estados) podem
+// ir para qualquer estado válido.
+func checkTransition(from, to InstanceState) error {
+	if !to.Valid() {
+		return fmt.Errorf("%w: estado desconhecido %q", ErrInvalidTransition, to)
+	}
+	if from.Valid() && !from.CanTransition(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	return nil
+}
+
+// ParseEvolutionState converte o status informado pela Evolution
+// (connectionStatus: open, connecting, close).
+func ParseEvolutionState(status string) InstanceState {
+	switch status {
+	case "open":
+		return StateOpen
+	case "connecting":
+		return StateConnecting
+	case "close":
+		return StateClosed
+	default:
+		return StateError
+	}
+}
+
+// Observe retorna o estado da instância dado o status informado pela
+// Evolution. A Evolution não distingue uma instância aguardando o QR code ou
+// deslogada de uma desconectada, então esses estados são mantidos enquanto
+// ela não estiver conectada.
+func (s InstanceState) Observe(status string) InstanceState {
+	reported := ParseEvolutionState(status)
+	switch {
+	case s == StateQRPending && (reported == StateConnecting || reported == StateClosed):
+		return s
+	case s == StateLoggedOut && reported == StateClosed:
+		return s
+	}
+	return reported
+}
+
+// migrateInstanceStates converte os status gravados antes da máquina de
+// estados ("close" da Evolution) para os estados atuais.
+func migrateInstanceStates(db *gorm.DB) error {
+	if err := db.Model(&Instance{}).Where("status = ?", "close").Update("status", StateClosed).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&InstanceStatusChange{}).Where("from_status = ?", "close").Update("from_status", StateClosed).Error; err != nil {
+		return err
+	}
+	return db.Model(&InstanceStatusChange{}).Where("to_status = ?", "close").Update("to_status", StateClosed).Error
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tenant é um cliente do manager. Ele se autentica com a própria chave no
+// header apikey e só enxerga as instâncias, assinaturas e eventos dele.
+type Tenant struct {
+	ID   int    `gorm:"primary_key" json:"id"`
+	Name string `gorm:"uniqueIndex" json:"name"`
+	// KeyHash é o SHA-256 da chave; a chave só é devolvida na criação.
+	KeyHash   string    `gorm:"uniqueIndex" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateTenant cria o tenant com uma chave aleatória e devolve a chave.
+func CreateTenant(db *gorm.DB, tenant *Tenant) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(random)
+
+	tenant.KeyHash = HashTenantKey(key)
+	if err := db.Create(tenant).Error; err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// HashTenantKey calcula o hash guardado em Tenant.KeyHash.
+func HashTenantKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Estados de um FleetUpgrade.
+const (
+	UpgradeRunning   = "running"
+	UpgradePaused    = "paused"
+	UpgradeCompleted = "completed"
+)
+
+// FleetUpgrade troca a imagem da Evolution API em todos os servidores, um de
+// cada vez, na ordem do id. Se um servidor falhar o upgrade pausa nele até
+// ser retomado.
+type FleetUpgrade struct {
+	ID int `gorm:"primary_key" json:"id"`
+	// Image vazia reimplanta cada servidor com a imagem que ele já usa, só
+	// para atualizar o ambiente da stack (ver POST /fleet/redeploy).
+	Image string `json:"image"`
+	State string `gorm:"index" json:"state"`
+	// LastServerID é o último servidor atualizado com sucesso.
+	LastServerID int `json:"last_server_id"`
+	// CurrentServerID é o servidor sendo atualizado (ou em que o upgrade
+	// pausou).
+	CurrentServerID int `json:"current_server_id"`
+	// SkippedServerIDs são os servidores pulados por estarem sendo
+	// provisionados ou em decommission, ou por não terem IP para o acesso
+	// SSH; continuam com a imagem e o ambiente anteriores.
+	SkippedServerIDs []int     `gorm:"serializer:json" json:"skipped_server_ids"`
+	Error            string    `json:"error"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
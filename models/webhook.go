@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Estados de uma WebhookDelivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription é um webhook de cliente que recebe os eventos das
+// instâncias, independente do servidor onde elas estão. Uma assinatura vale
+// para uma instância (InstanceName) ou para todas as de um tenant (Tenant).
+// Com os dois, vale para a instância enquanto ela for do tenant; Tenant é o
+// dono da assinatura e quem pode vê-la.
+type WebhookSubscription struct {
+	ID           int    `gorm:"primary_key" json:"id"`
+	URL          string `json:"url"`
+	InstanceName string `gorm:"index" json:"instance_name,omitempty"`
+	Tenant       string `gorm:"index" json:"tenant,omitempty"`
+	// Events são os eventos assinados, separados por vírgula (ex.:
+	// connection.update,messages.upsert). Vazio assina todos.
+	Events string `json:"events"`
+	// Secret assina os payloads com HMAC-SHA256; só é devolvido na criação.
+	Secret    string    `json:"-"`
+	Disabled  bool      `gorm:"default:false" json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery é o envio de um evento para uma assinatura. Falhas são
+// tentadas de novo em NextAttemptAt, com backoff exponencial.
+type WebhookDelivery struct {
+	ID             int       `gorm:"primary_key" json:"id"`
+	SubscriptionID int       `gorm:"index" json:"subscription_id"`
+	Event          string    `json:"event"`
+	InstanceName   string    `json:"instance_name"`
+	Payload        string    `json:"payload"`
+	State          string    `gorm:"index" json:"state"`
+	Attempts       int       `json:"attempts"`
+	NextAttemptAt  time.Time `gorm:"index" json:"next_attempt_at"`
+	LastStatusCode int       `json:"last_status_code"`
+	LastError      string    `json:"last_error"`
+	// ReplayOf é a entrega original quando esta é um replay.
+	ReplayOf    int        `json:"replay_of,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+}
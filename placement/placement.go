@@ -0,0 +1,196 @@
+package placement
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+)
+
+// DefaultCapacity é usado para servidores sem capacidade configurada.
+const DefaultCapacity = 20
+
+const (
+	LeastLoaded        = "least-loaded"
+	BinPack            = "bin-pack"
+	WeightedRoundRobin = "weighted-round-robin"
+	RandomOfTwo        = "random-of-two"
+)
+
+// Placement escolhe em qual servidor uma nova instância deve ser criada.
+type Placement interface {
+	// Pick retorna o servidor escolhido entre os candidatos, ou false quando
+	// nenhum deles tem vaga (servidores cordoned nunca são escolhidos).
+	Pick(servers []models.Result) (models.Result, bool)
+}
+
+// New retorna a estratégia com o nome informado.
+func New(name string) (Placement, error) {
+	switch name {
+	case LeastLoaded:
+		return leastLoaded{}, nil
+	case BinPack, "":
+		return binPack{}, nil
+	case WeightedRoundRobin:
+		return &weightedRoundRobin{current: map[int]int{}}, nil
+	case RandomOfTwo:
+		return &randomOfTwo{}, nil
+	default:
+		return nil, fmt.Errorf("estratégia de placement desconhecida: %q", name)
+	}
+}
+
+var (
+	defaultPlacement Placement
+	defaultOnce      sync.Once
+)
+
+// Default retorna a estratégia configurada em PLACEMENT_STRATEGY. Na ausência
+// de configuração (ou com valor inválido) usa bin-pack, que enche um servidor
+// antes de passar para o próximo.
+func Default() Placement {
+	defaultOnce.Do(func() {
+		strategy, err := New(os.Getenv("PLACEMENT_STRATEGY"))
+		if err != nil {
+			fmt.Println("Erro ao configurar placement, usando bin-pack:", err)
+			strategy = binPack{}
+		}
+		defaultPlacement = strategy
+	})
+	return defaultPlacement
+}
+
+// Capacity retorna a capacidade do servidor, usando DefaultCapacity quando
+// ela não foi configurada.
+func Capacity(server models.Result) int {
+	if server.Capacity <= 0 {
+		return DefaultCapacity
+	}
+	return server.Capacity
+}
+
+func free(server models.Result) int {
+	return Capacity(server) - server.CountOpen
+}
+
+func hasRoom(server models.Result) bool {
+	return free(server) > 0
+}
+
+// available retorna os servidores que podem receber instâncias: não estão
+// cordoned e têm vaga.
+func available(servers []models.Result) []models.Result {
+	var candidates []models.Result
+	for _, server := range servers {
+		if !server.Cordoned && hasRoom(server) {
+			candidates = append(candidates, server)
+		}
+	}
+	return candidates
+}
+
+// leastLoaded espalha as instâncias, escolhendo o servidor com mais vagas.
+type leastLoaded struct{}
+
+func (leastLoaded) Pick(servers []models.Result) (models.Result, bool) {
+	var best models.Result
+	found := false
+	for _, server := range available(servers) {
+		if !found || free(server) > free(best) ||
+			(free(server) == free(best) && server.ID < best.ID) {
+			best = server
+			found = true
+		}
+	}
+	return best, found
+}
+
+// binPack concentra as instâncias, escolhendo o servidor com menos vagas
+// (mas ainda com alguma).
+type binPack struct{}
+
+func (binPack) Pick(servers []models.Result) (models.Result, bool) {
+	var best models.Result
+	found := false
+	for _, server := range available(servers) {
+		if !found || free(server) < free(best) ||
+			(free(server) == free(best) && server.ID < best.ID) {
+			best = server
+			found = true
+		}
+	}
+	return best, found
+}
+
+// weightedRoundRobin alterna entre os servidores com vaga usando o algoritmo
+// smooth weighted round-robin (o mesmo do nginx).
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[int]int
+}
+
+func (p *weightedRoundRobin) Pick(servers []models.Result) (models.Result, bool) {
+	candidates := available(servers)
+	if len(candidates) == 0 {
+		return models.Result{}, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := 0
+	best := -1
+	for i, server := range candidates {
+		weight := serverWeight(server)
+		total += weight
+		p.current[server.ID] += weight
+		if best == -1 || p.current[server.ID] > p.current[candidates[best].ID] {
+			best = i
+		}
+	}
+	p.current[candidates[best].ID] -= total
+
+	return candidates[best], true
+}
+
+func serverWeight(server models.Result) int {
+	if server.Weight <= 0 {
+		return 1
+	}
+	return server.Weight
+}
+
+// randomOfTwo sorteia dois servidores com vaga e fica com o que tem mais vagas,
+// o que aproxima o least-loaded sem que todos escolham o mesmo servidor.
+type randomOfTwo struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func (p *randomOfTwo) Pick(servers []models.Result) (models.Result, bool) {
+	candidates := available(servers)
+	switch len(candidates) {
+	case 0:
+		return models.Result{}, false
+	case 1:
+		return candidates[0], true
+	}
+
+	p.mu.Lock()
+	if p.rnd == nil {
+		p.rnd = rand.New(rand.NewSource(rand.Int63()))
+	}
+	i := p.rnd.Intn(len(candidates))
+	j := p.rnd.Intn(len(candidates) - 1)
+	p.mu.Unlock()
+	if j >= i {
+		j++
+	}
+
+	if free(candidates[j]) > free(candidates[i]) {
+		return candidates[j], true
+	}
+	return candidates[i], true
+}
@@ -0,0 +1,224 @@
+package placement
+
+import (
+	"testing"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+)
+
+func TestPick(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		servers  []models.Result
+		wantID   int
+		wantOK   bool
+	}{
+		{
+			name:     "least-loaded escolhe o servidor com mais vagas",
+			strategy: LeastLoaded,
+			servers: []models.Result{
+				{ID: 1, Capacity: 10, CountOpen: 8},
+				{ID: 2, Capacity: 10, CountOpen: 3},
+				{ID: 3, Capacity: 20, CountOpen: 15},
+			},
+			wantID: 2,
+			wantOK: true,
+		},
+		{
+			name:     "least-loaded desempata pelo menor id",
+			strategy: LeastLoaded,
+			servers: []models.Result{
+				{ID: 2, Capacity: 10, CountOpen: 5},
+				{ID: 1, Capacity: 10, CountOpen: 5},
+			},
+			wantID: 1,
+			wantOK: true,
+		},
+		{
+			name:     "least-loaded usa a capacidade padrão",
+			strategy: LeastLoaded,
+			servers: []models.Result{
+				{ID: 1, Capacity: 10, CountOpen: 0},
+				{ID: 2, CountOpen: 5},
+			},
+			wantID: 2,
+			wantOK: true,
+		},
+		{
+			name:     "bin-pack escolhe o servidor com menos vagas",
+			strategy: BinPack,
+			servers: []models.Result{
+				{ID: 1, Capacity: 10, CountOpen: 2},
+				{ID: 2, Capacity: 10, CountOpen: 9},
+				{ID: 3, Capacity: 10, CountOpen: 5},
+			},
+			wantID: 2,
+			wantOK: true,
+		},
+		{
+			name:     "servidores cheios são descartados",
+			strategy: BinPack,
+			servers: []models.Result{
+				{ID: 1, Capacity: 10, CountOpen: 10},
+				{ID: 2, Capacity: 10, CountOpen: 12},
+				{ID: 3, Capacity: 10, CountOpen: 4},
+			},
+			wantID: 3,
+			wantOK: true,
+		},
+		{
+			name:     "servidores cordoned são descartados",
+			strategy: LeastLoaded,
+			servers: []models.Result{
+				{ID: 1, Capacity: 10, CountOpen: 0, Cordoned: true},
+				{ID: 2, Capacity: 10, CountOpen: 7},
+			},
+			wantID: 2,
+			wantOK: true,
+		},
+		{
+			name:     "random-of-two com um único candidato",
+			strategy: RandomOfTwo,
+			servers: []models.Result{
+				{ID: 1, Capacity: 10, CountOpen: 10},
+				{ID: 2, Capacity: 10, CountOpen: 1},
+				{ID: 3, Capacity: 10, CountOpen: 0, Cordoned: true},
+			},
+			wantID: 2,
+			wantOK: true,
+		},
+		{
+			name:     "sem servidores",
+			strategy: LeastLoaded,
+			wantOK:   false,
+		},
+		{
+			name:     "todos cheios ou cordoned",
+			strategy: BinPack,
+			servers: []models.Result{
+				{ID: 1, Capacity: 10, CountOpen: 10},
+				{ID: 2, Capacity: 10, CountOpen: 0, Cordoned: true},
+			},
+			wantOK: false,
+		},
+		{
+			name:     "weighted round-robin sem candidatos",
+			strategy: WeightedRoundRobin,
+			servers: []models.Result{
+				{ID: 1, Capacity: 10, CountOpen: 10, Weight: 3},
+			},
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := New(tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := strategy.Pick(tt.servers)
+			if ok != tt.wantOK {
+				t.Fatalf("Pick() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got.ID != tt.wantID {
+				t.Errorf("Pick() = servidor %d, want %d", got.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []models.Result
+		picks   int
+		want    map[int]int
+	}{
+		{
+			name: "distribui proporcionalmente ao peso",
+			servers: []models.Result{
+				{ID: 1, Capacity: 100, Weight: 3},
+				{ID: 2, Capacity: 100, Weight: 1},
+			},
+			picks: 8,
+			want:  map[int]int{1: 6, 2: 2},
+		},
+		{
+			name: "peso não configurado vale 1",
+			servers: []models.Result{
+				{ID: 1, Capacity: 100},
+				{ID: 2, Capacity: 100},
+				{ID: 3, Capacity: 100},
+			},
+			picks: 6,
+			want:  map[int]int{1: 2, 2: 2, 3: 2},
+		},
+		{
+			name: "ignora servidores cheios e cordoned",
+			servers: []models.Result{
+				{ID: 1, Capacity: 100, Weight: 5, Cordoned: true},
+				{ID: 2, Capacity: 10, CountOpen: 10, Weight: 5},
+				{ID: 3, Capacity: 100, Weight: 1},
+			},
+			picks: 4,
+			want:  map[int]int{3: 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := New(WeightedRoundRobin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[int]int{}
+			for i := 0; i < tt.picks; i++ {
+				server, ok := strategy.Pick(tt.servers)
+				if !ok {
+					t.Fatalf("Pick() sem servidor na escolha %d", i)
+				}
+				got[server.ID]++
+			}
+
+			for id, count := range tt.want {
+				if got[id] != count {
+					t.Errorf("servidor %d escolhido %d vezes, want %d (%v)", id, got[id], count, got)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("servidores escolhidos = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobinIsSmooth(t *testing.T) {
+	strategy, err := New(WeightedRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := []models.Result{
+		{ID: 1, Capacity: 100, Weight: 5},
+		{ID: 2, Capacity: 100, Weight: 1},
+		{ID: 3, Capacity: 100, Weight: 1},
+	}
+
+	// Sequência do smooth weighted round-robin do nginx para pesos 5, 1, 1.
+	want := []int{1, 1, 2, 1, 3, 1, 1}
+	for i, id := range want {
+		server, _ := strategy.Pick(servers)
+		if server.ID != id {
+			t.Fatalf("escolha %d = servidor %d, want %d", i, server.ID, id)
+		}
+	}
+}
+
+func TestNewUnknownStrategy(t *testing.T) {
+	if _, err := New("round-robin"); err == nil {
+		t.Error("New() aceitou uma estratégia desconhecida")
+	}
+}
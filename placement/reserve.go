@@ -0,0 +1,116 @@
+package placement
+
+import (
+	"errors"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"gorm.io/gorm"
+)
+
+// lockKey identifica o advisory lock do Postgres que serializa as reservas de
+// vaga entre requisições (e entre réplicas do manager).
+const lockKey = 0x77736d01
+
+// ErrNoServerAvailable indica que nenhum servidor schedulable tem vaga.
+var ErrNoServerAvailable = errors.New("nenhum servidor disponível")
+
+// loadServers retorna os servidores com a contagem de instâncias que ocupam
+// vaga (models.SlotStates) em cada um. Os cordoned vêm marcados e são
+// descartados pelas estratégias (ver available).
+func loadServers(tx *gorm.DB) ([]models.Result, error) {
+	var servers []models.Result
+
+	err := tx.Table("servers").
+		Select("servers.url, servers.id, servers.capacity, servers.weight, servers.cordoned, COUNT(instances.id) AS count_open").
+		Joins("LEFT JOIN instances ON servers.id = instances.server_id AND instances.status IN ?", models.SlotStates).
+		Group("servers.url, servers.id, servers.capacity, servers.weight, servers.cordoned").
+		Order("servers.id").
+		Scan(&servers).Error
+
+	return servers, err
+}
+
+// withLock executa fn em uma transação que detém o advisory lock de placement.
+func withLock(fn func(tx *gorm.DB, servers []models.Result) error) error {
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockKey).Error; err != nil {
+			return err
+		}
+
+		servers, err := loadServers(tx)
+		if err != nil {
+			return err
+		}
+
+		return fn(tx, servers)
+	})
+}
+
+// Reserve escolhe um servidor com a estratégia padrão e grava a instância
+// nele dentro da mesma transação. Assim requisições simultâneas enxergam as
+// reservas umas das outras e a capacidade de cada servidor é respeitada
+// exatamente. Retorna a instância gravada, a URL do servidor e quantas vagas
+// livres restaram na frota.
+func Reserve(input models.Instance) (models.Instance, string, int, error) {
+	var reserved models.Instance
+	var serverUrl string
+	freeSlots := 0
+
+	err := withLock(func(tx *gorm.DB, servers []models.Result) error {
+		for _, s := range available(servers) {
+			freeSlots += free(s)
+		}
+
+		server, ok := Default().Pick(servers)
+		if !ok {
+			return ErrNoServerAvailable
+		}
+
+		reserved = models.Instance{
+			Name:     input.Name,
+			Status:   input.Status,
+			ServerID: server.ID,
+			Apikey:   input.Apikey,
+			Tenant:   input.Tenant,
+		}
+		if err := tx.Create(&reserved).Error; err != nil {
+			return err
+		}
+
+		serverUrl = server.URL
+		freeSlots--
+		return nil
+	})
+
+	return reserved, serverUrl, freeSlots, err
+}
+
+// Relocate move a instância para outro servidor schedulable, escolhido com a
+// estratégia padrão, e retorna o servidor de destino.
+func Relocate(instance *models.Instance) (models.Result, error) {
+	var target models.Result
+
+	err := withLock(func(tx *gorm.DB, servers []models.Result) error {
+		var candidates []models.Result
+		for _, s := range servers {
+			if s.ID != instance.ServerID {
+				candidates = append(candidates, s)
+			}
+		}
+
+		server, ok := Default().Pick(candidates)
+		if !ok {
+			return ErrNoServerAvailable
+		}
+
+		err := tx.Model(instance).Update("server_id", server.ID).Error
+		if err != nil {
+			return err
+		}
+
+		target = server
+		return nil
+	})
+
+	return target, err
+}
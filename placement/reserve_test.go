@@ -0,0 +1,86 @@
+package placement
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models/modelstest"
+)
+
+func TestReserveParallel(t *testing.T) {
+	modelstest.Setup(t)
+
+	const capacity = 5
+	servers := []models.Server{
+		{Name: "a", URL: "http://a", Capacity: capacity, Weight: 1},
+		{Name: "b", URL: "http://b", Capacity: capacity, Weight: 1},
+		{Name: "cordoned", URL: "http://c", Capacity: capacity, Weight: 1, Cordoned: true},
+	}
+	if err := models.DB.Create(&servers).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 30
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+		full     int
+		failures []error
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			_, _, _, err := Reserve(models.Instance{
+				Name:   fmt.Sprintf("instance-%d", i),
+				Status: models.StateCreating,
+				Apikey: fmt.Sprintf("key-%d", i),
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				reserved++
+			case errors.Is(err, ErrNoServerAvailable):
+				full++
+			default:
+				failures = append(failures, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		t.Fatalf("erros inesperados: %v", failures)
+	}
+	if reserved != 2*capacity || full != requests-2*capacity {
+		t.Errorf("%d reservas e %d recusas, want %d e %d", reserved, full, 2*capacity, requests-2*capacity)
+	}
+
+	type count struct {
+		ServerID int
+		Total    int
+	}
+	var counts []count
+	err := models.DB.Model(&models.Instance{}).
+		Select("server_id, COUNT(*) AS total").
+		Group("server_id").
+		Scan(&counts).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range counts {
+		if c.ServerID == servers[2].ID {
+			t.Errorf("servidor cordoned recebeu %d instâncias", c.Total)
+		}
+		if c.Total > capacity {
+			t.Errorf("servidor %d com %d instâncias (capacidade %d)", c.ServerID, c.Total, capacity)
+		}
+	}
+}
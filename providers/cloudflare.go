@@ -0,0 +1,153 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// CloudflareConfig reúne as credenciais da zona usada para os servidores.
+type CloudflareConfig struct {
+	APIURL string
+	ZoneID string
+	Token  string
+}
+
+// CloudflareConfigFromEnv lê a configuração das variáveis CLOUDFLARE_*.
+func CloudflareConfigFromEnv() CloudflareConfig {
+	return CloudflareConfig{
+		APIURL: envOrDefault("CLOUDFLARE_API_URL", "https://api.cloudflare.com/client/v4"),
+		ZoneID: os.Getenv("CLOUDFLARE_ZONE_ID"),
+		Token:  os.Getenv("CLOUDFLARE_API_TOKEN"),
+	}
+}
+
+// Cloudflare implementa DNSProvider usando a API v4 da Cloudflare.
+type Cloudflare struct {
+	config CloudflareConfig
+	client *http.Client
+}
+
+// NewCloudflare cria o cliente da Cloudflare.
+func NewCloudflare(config CloudflareConfig) (*Cloudflare, error) {
+	if config.ZoneID == "" || config.Token == "" {
+		return nil, errors.New("CLOUDFLARE_ZONE_ID e CLOUDFLARE_API_TOKEN são obrigatórios")
+	}
+
+	return &Cloudflare{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (c *Cloudflare) CreateRecord(ctx context.Context, record DNSRecord) (DNSRecord, error) {
+	record.ID = ""
+
+	var created DNSRecord
+	err := c.do(ctx, http.MethodPost, "", record, &created)
+	return created, err
+}
+
+func (c *Cloudflare) UpdateRecord(ctx context.Context, record DNSRecord) (DNSRecord, error) {
+	if record.ID == "" {
+		return DNSRecord{}, errors.New("registro sem id")
+	}
+
+	var updated DNSRecord
+	err := c.do(ctx, http.MethodPut, "/"+record.ID, record, &updated)
+	return updated, err
+}
+
+func (c *Cloudflare) DeleteRecord(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/"+id, nil, nil)
+}
+
+func (c *Cloudflare) ListRecords(ctx context.Context, name string) ([]DNSRecord, error) {
+	var records []DNSRecord
+
+	page := 1
+	for {
+		query := url.Values{}
+		query.Set("page", fmt.Sprint(page))
+		query.Set("per_page", "100")
+		if name != "" {
+			query.Set("name", name)
+		}
+
+		var result []DNSRecord
+		if err := c.do(ctx, http.MethodGet, "?"+query.Encode(), nil, &result); err != nil {
+			return nil, err
+		}
+		records = append(records, result...)
+
+		if len(result) < 100 {
+			return records, nil
+		}
+		page++
+	}
+}
+
+// do chama o endpoint de dns_records da zona. Respostas fora de 2xx ou com
+// success=false viram erro; 404 vira ErrNotFound.
+func (c *Cloudflare) do(ctx context.Context, method string, path string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payloadBytes)
+	}
+
+	endpoint := fmt.Sprintf("%s/zones/%s/dns_records%s", strings.TrimRight(c.config.APIURL, "/"), c.config.ZoneID, path)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	var response cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("cloudflare: %s: status %d: %w", method, resp.StatusCode, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || !response.Success {
+		if len(response.Errors) > 0 {
+			return fmt.Errorf("cloudflare: %s: %s (%d)", method, response.Errors[0].Message, response.Errors[0].Code)
+		}
+		return fmt.Errorf("cloudflare: %s: status %d", method, resp.StatusCode)
+	}
+
+	if out == nil || len(response.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(response.Result, out)
+}
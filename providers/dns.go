@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// DNSRecord é um registro de DNS. ID é atribuído pelo provedor.
+type DNSRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl,omitempty"`
+	Proxied bool   `json:"proxied"`
+}
+
+// DNSProvider gerencia os registros que apontam para os servidores.
+type DNSProvider interface {
+	CreateRecord(ctx context.Context, record DNSRecord) (DNSRecord, error)
+	UpdateRecord(ctx context.Context, record DNSRecord) (DNSRecord, error)
+	DeleteRecord(ctx context.Context, id string) error
+	// ListRecords retorna os registros com o nome informado, ou todos quando
+	// name é vazio.
+	ListRecords(ctx context.Context, name string) ([]DNSRecord, error)
+}
+
+// NewDNS retorna o provedor de DNS com o nome informado, configurado pelo
+// ambiente.
+func NewDNS(name string) (DNSProvider, error) {
+	switch name {
+	case "cloudflare", "":
+		return NewCloudflare(CloudflareConfigFromEnv())
+	case "memory":
+		return NewMemoryDNS(), nil
+	default:
+		return nil, fmt.Errorf("provedor de DNS desconhecido: %q", name)
+	}
+}
+
+var (
+	defaultDNS     DNSProvider
+	defaultDNSErr  error
+	defaultDNSOnce sync.Once
+)
+
+// DefaultDNS retorna o provedor configurado em DNS_PROVIDER (cloudflare por
+// padrão).
+func DefaultDNS() (DNSProvider, error) {
+	defaultDNSOnce.Do(func() {
+		defaultDNS, defaultDNSErr = NewDNS(os.Getenv("DNS_PROVIDER"))
+	})
+	return defaultDNS, defaultDNSErr
+}
@@ -0,0 +1,65 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryDNS é um DNSProvider em memória, para testes e desenvolvimento local.
+type MemoryDNS struct {
+	mu      sync.Mutex
+	nextID  int
+	records map[string]DNSRecord
+}
+
+func NewMemoryDNS() *MemoryDNS {
+	return &MemoryDNS{nextID: 1, records: map[string]DNSRecord{}}
+}
+
+func (m *MemoryDNS) CreateRecord(ctx context.Context, record DNSRecord) (DNSRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record.ID = fmt.Sprintf("memory-%d", m.nextID)
+	m.nextID++
+	m.records[record.ID] = record
+	return record, nil
+}
+
+func (m *MemoryDNS) UpdateRecord(ctx context.Context, record DNSRecord) (DNSRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.records[record.ID]; !ok {
+		return DNSRecord{}, ErrNotFound
+	}
+	m.records[record.ID] = record
+	return record, nil
+}
+
+func (m *MemoryDNS) DeleteRecord(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.records[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.records, id)
+	return nil
+}
+
+func (m *MemoryDNS) ListRecords(ctx context.Context, name string) ([]DNSRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var records []DNSRecord
+	for _, record := range m.records {
+		if name == "" || record.Name == name {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
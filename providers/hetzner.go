@@ -0,0 +1,279 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HetznerConfig reúne as opções usadas para criar servidores na Hetzner Cloud.
+type HetznerConfig struct {
+	APIURL     string
+	Token      string
+	Image      string
+	ServerType string
+	Location   string
+	Firewalls  []int
+	SSHKeys    []int
+}
+
+// HetznerConfigFromEnv lê a configuração das variáveis HETZNER_*.
+// HETZNER_FIREWALL_IDS e HETZNER_SSH_KEY_IDS são listas separadas por vírgula.
+func HetznerConfigFromEnv() HetznerConfig {
+	return HetznerConfig{
+		APIURL:     envOrDefault("HETZNER_API_URL", "https://api.hetzner.cloud/v1"),
+		Token:      os.Getenv("HETZNER_API_TOKEN"),
+		Image:      envOrDefault("HETZNER_IMAGE", "ubuntu-22.04"),
+		ServerType: envOrDefault("HETZNER_SERVER_TYPE", "cx11"),
+		Location:   os.Getenv("HETZNER_LOCATION"),
+		Firewalls:  envIntList("HETZNER_FIREWALL_IDS"),
+		SSHKeys:    envIntList("HETZNER_SSH_KEY_IDS"),
+	}
+}
+
+// Hetzner implementa Provider usando a API da Hetzner Cloud.
+type Hetzner struct {
+	config HetznerConfig
+	client *http.Client
+}
+
+// NewHetzner cria o cliente da Hetzner Cloud.
+func NewHetzner(config HetznerConfig) (*Hetzner, error) {
+	if config.Token == "" {
+		return nil, errors.New("HETZNER_API_TOKEN não configurado")
+	}
+
+	return &Hetzner{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (h *Hetzner) Name() string {
+	return "hetzner"
+}
+
+type hetznerFirewall struct {
+	Firewall int `json:"firewall"`
+}
+
+type hetznerCreateRequest struct {
+	Firewalls        []hetznerFirewall `json:"firewalls,omitempty"`
+	Image            string            `json:"image"`
+	Name             string            `json:"name"`
+	ServerType       string            `json:"server_type"`
+	Location         string            `json:"location,omitempty"`
+	SSHKeys          []int             `json:"ssh_keys,omitempty"`
+	StartAfterCreate bool              `json:"start_after_create"`
+}
+
+type hetznerServer struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	PublicNet struct {
+		IPv4 struct {
+			IP string `json:"ip"`
+		} `json:"ipv4"`
+	} `json:"public_net"`
+}
+
+func (s hetznerServer) machine() Machine {
+	return Machine{
+		ID:     strconv.Itoa(s.ID),
+		Name:   s.Name,
+		IP:     s.PublicNet.IPv4.IP,
+		Status: s.Status,
+	}
+}
+
+type hetznerAction struct {
+	ID       int    `json:"id"`
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+	Error    *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (a hetznerAction) action() Action {
+	action := Action{ID: strconv.Itoa(a.ID), Status: a.Status, Progress: a.Progress}
+	if a.Error != nil {
+		action.Error = fmt.Sprintf("%s (%s)", a.Error.Message, a.Error.Code)
+	}
+	return action
+}
+
+type hetznerServerResponse struct {
+	Server hetznerServer `json:"server"`
+	// Action só vem na criação.
+	Action *hetznerAction `json:"action,omitempty"`
+}
+
+type hetznerActionResponse struct {
+	Action hetznerAction `json:"action"`
+}
+
+type hetznerListResponse struct {
+	Servers []hetznerServer `json:"servers"`
+	Meta    struct {
+		Pagination struct {
+			NextPage *int `json:"next_page"`
+		} `json:"pagination"`
+	} `json:"meta"`
+}
+
+type hetznerErrorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (h *Hetzner) CreateServer(ctx context.Context, name string) (Machine, error) {
+	payload := hetznerCreateRequest{
+		Image:            h.config.Image,
+		Name:             name,
+		ServerType:       h.config.ServerType,
+		Location:         h.config.Location,
+		SSHKeys:          h.config.SSHKeys,
+		StartAfterCreate: true,
+	}
+	for _, id := range h.config.Firewalls {
+		payload.Firewalls = append(payload.Firewalls, hetznerFirewall{Firewall: id})
+	}
+
+	var response hetznerServerResponse
+	if err := h.do(ctx, http.MethodPost, "/servers", payload, &response); err != nil {
+		return Machine{}, err
+	}
+
+	machine := response.Server.machine()
+	if response.Action != nil {
+		machine.ActionID = strconv.Itoa(response.Action.ID)
+	}
+	return machine, nil
+}
+
+func (h *Hetzner) GetServer(ctx context.Context, id string) (Machine, error) {
+	var response hetznerServerResponse
+	if err := h.do(ctx, http.MethodGet, "/servers/"+id, nil, &response); err != nil {
+		return Machine{}, err
+	}
+
+	return response.Server.machine(), nil
+}
+
+func (h *Hetzner) DeleteServer(ctx context.Context, id string) error {
+	return h.do(ctx, http.MethodDelete, "/servers/"+id, nil, nil)
+}
+
+// GetAction consulta uma ação da Hetzner (GET /actions/{id}).
+func (h *Hetzner) GetAction(ctx context.Context, id string) (Action, error) {
+	var response hetznerActionResponse
+	if err := h.do(ctx, http.MethodGet, "/actions/"+id, nil, &response); err != nil {
+		return Action{}, err
+	}
+
+	return response.Action.action(), nil
+}
+
+func (h *Hetzner) ListServers(ctx context.Context) ([]Machine, error) {
+	var machines []Machine
+
+	page := 1
+	for {
+		var response hetznerListResponse
+		path := fmt.Sprintf("/servers?page=%d&per_page=50", page)
+		if err := h.do(ctx, http.MethodGet, path, nil, &response); err != nil {
+			return nil, err
+		}
+
+		for _, server := range response.Servers {
+			machines = append(machines, server.machine())
+		}
+
+		if response.Meta.Pagination.NextPage == nil {
+			return machines, nil
+		}
+		page = *response.Meta.Pagination.NextPage
+	}
+}
+
+func (h *Hetzner) do(ctx context.Context, method string, path string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payloadBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(h.config.APIURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+h.config.Token)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr hetznerErrorResponse
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("hetzner: %s %s: %s (%s)", method, path, apiErr.Error.Message, apiErr.Error.Code)
+		}
+		return fmt.Errorf("hetzner: %s %s: status %d", method, path, resp.StatusCode)
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func envOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envIntList(key string) []int {
+	var values []int
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		value, err := strconv.Atoi(item)
+		if err != nil {
+			fmt.Printf("Valor inválido em %s: %q\n", key, item)
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
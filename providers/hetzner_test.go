@@ -0,0 +1,69 @@
+package providers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/providers"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/providers/providertest"
+)
+
+func TestHetznerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	provider := providertest.NewHetzner(t).Provider()
+
+	created, err := provider.CreateServer(ctx, "evolution-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.IP == "" || created.Name != "evolution-1" || created.ActionID == "" {
+		t.Fatalf("CreateServer() = %+v", created)
+	}
+
+	action, err := provider.GetAction(ctx, created.ActionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.ID != created.ActionID || action.Status != providers.ActionSuccess {
+		t.Errorf("GetAction() = %+v", action)
+	}
+
+	if _, err := provider.CreateServer(ctx, "evolution-1"); err == nil {
+		t.Error("CreateServer() aceitou um nome repetido")
+	}
+
+	got, err := provider.GetServer(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := created
+	want.ActionID = ""
+	if got != want {
+		t.Errorf("GetServer() = %+v, want %+v", got, want)
+	}
+
+	machines, err := provider.ListServers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(machines) != 1 || machines[0].ID != created.ID {
+		t.Errorf("ListServers() = %+v", machines)
+	}
+
+	if err := provider.DeleteServer(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.GetServer(ctx, created.ID); !errors.Is(err, providers.ErrNotFound) {
+		t.Errorf("GetServer() depois do delete: err = %v, want ErrNotFound", err)
+	}
+	if err := provider.DeleteServer(ctx, created.ID); !errors.Is(err, providers.ErrNotFound) {
+		t.Errorf("DeleteServer() repetido: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNewUnknownProvider(t *testing.T) {
+	if _, err := providers.New("fake"); err == nil {
+		t.Error("New() aceitou um provedor desconhecido")
+	}
+}
@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Machine é uma máquina virtual em um provedor de nuvem. ActionID só vem
+// preenchido por CreateServer: é a ação do provedor que cria a máquina.
+type Machine struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	IP       string `json:"ip"`
+	Status   string `json:"status"`
+	ActionID string `json:"action_id,omitempty"`
+}
+
+// Estados de uma Action.
+const (
+	ActionRunning = "running"
+	ActionSuccess = "success"
+	ActionError   = "error"
+)
+
+// Action é uma operação assíncrona do provedor (ex.: a criação da máquina).
+type Action struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ErrNotFound é retornado quando a máquina ou o registro não existe no
+// provedor.
+var ErrNotFound = errors.New("recurso não encontrado no provedor")
+
+// Provider cria e gerencia as máquinas que rodam a Evolution API.
+type Provider interface {
+	// Name identifica o provedor (ex.: "hetzner"), gravado em models.Server.
+	Name() string
+	CreateServer(ctx context.Context, name string) (Machine, error)
+	GetServer(ctx context.Context, id string) (Machine, error)
+	DeleteServer(ctx context.Context, id string) error
+	ListServers(ctx context.Context) ([]Machine, error)
+	GetAction(ctx context.Context, id string) (Action, error)
+}
+
+// New retorna o provedor com o nome informado, configurado pelo ambiente.
+func New(name string) (Provider, error) {
+	switch name {
+	case "hetzner", "":
+		return NewHetzner(HetznerConfigFromEnv())
+	default:
+		return nil, fmt.Errorf("provedor desconhecido: %q", name)
+	}
+}
+
+var (
+	defaultProvider Provider
+	defaultErr      error
+	defaultOnce     sync.Once
+)
+
+// Default retorna o provedor configurado em CLOUD_PROVIDER (hetzner por padrão).
+func Default() (Provider, error) {
+	defaultOnce.Do(func() {
+		defaultProvider, defaultErr = New(os.Getenv("CLOUD_PROVIDER"))
+	})
+	return defaultProvider, defaultErr
+}
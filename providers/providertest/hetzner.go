@@ -0,0 +1,228 @@
+// Package providertest traz fakes dos provedores para os testes dos pacotes
+// que criam e removem máquinas, sem acesso à internet e sem custo.
+package providertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/providers"
+)
+
+// Hetzner é um servidor HTTP em memória que imita o subconjunto da API da
+// Hetzner Cloud usado pelo manager.
+type Hetzner struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	nextID  int
+	servers map[int]hetznerServer
+	actions map[int]hetznerAction
+}
+
+// Formato dos objetos na API da Hetzner; providers guarda os seus sem
+// exportar, e o fake precisa produzir o mesmo JSON.
+type hetznerServer struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	PublicNet struct {
+		IPv4 struct {
+			IP string `json:"ip"`
+		} `json:"ipv4"`
+	} `json:"public_net"`
+}
+
+type hetznerError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type hetznerAction struct {
+	ID       int           `json:"id"`
+	Status   string        `json:"status"`
+	Progress int           `json:"progress"`
+	Error    *hetznerError `json:"error"`
+}
+
+// NewHetzner inicia o fake, que é fechado no fim do teste.
+func NewHetzner(t testing.TB) *Hetzner {
+	t.Helper()
+
+	fake := &Hetzner{nextID: 1, servers: map[int]hetznerServer{}, actions: map[int]hetznerAction{}}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+// URL é o endereço da API fake.
+func (f *Hetzner) URL() string {
+	return f.server.URL
+}
+
+// Provider retorna um providers.Hetzner apontado para o fake.
+func (f *Hetzner) Provider() *providers.Hetzner {
+	provider, err := providers.NewHetzner(providers.HetznerConfig{
+		APIURL:     f.server.URL,
+		Token:      "fake",
+		Image:      "ubuntu-22.04",
+		ServerType: "cx11",
+	})
+	if err != nil {
+		// Só acontece sem token, e o token é fixo.
+		panic(err)
+	}
+	return provider
+}
+
+// AddMachine cadastra uma máquina running sem ação de criação, como as
+// criadas fora do manager ou antes de o id ser gravado.
+func (f *Hetzner) AddMachine(name string, ip string) providers.Machine {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	server := f.addServer(name, ip)
+	return machine(server)
+}
+
+// SetAction muda o estado de uma ação; message só é usado com
+// providers.ActionError.
+func (f *Hetzner) SetAction(id string, status string, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	actionID, _ := strconv.Atoi(id)
+	action := hetznerAction{ID: actionID, Status: status}
+	switch status {
+	case providers.ActionSuccess:
+		action.Progress = 100
+	case providers.ActionError:
+		action.Error = &hetznerError{Code: "action_failed", Message: message}
+	}
+	f.actions[actionID] = action
+}
+
+// Machines lista as máquinas existentes no fake, em ordem de criação.
+func (f *Hetzner) Machines() []providers.Machine {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var machines []providers.Machine
+	for _, server := range f.sortedServers() {
+		machines = append(machines, machine(server))
+	}
+	return machines
+}
+
+func (f *Hetzner) addServer(name string, ip string) hetznerServer {
+	server := hetznerServer{ID: f.nextID, Name: name, Status: "running"}
+	if ip == "" {
+		ip = fmt.Sprintf("10.0.0.%d", f.nextID)
+	}
+	server.PublicNet.IPv4.IP = ip
+	f.servers[server.ID] = server
+	f.nextID++
+	return server
+}
+
+func (f *Hetzner) sortedServers() []hetznerServer {
+	servers := make([]hetznerServer, 0, len(f.servers))
+	for _, server := range f.servers {
+		servers = append(servers, server)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ID < servers[j].ID })
+	return servers
+}
+
+func machine(server hetznerServer) providers.Machine {
+	return providers.Machine{
+		ID:     strconv.Itoa(server.ID),
+		Name:   server.Name,
+		IP:     server.PublicNet.IPv4.IP,
+		Status: server.Status,
+	}
+}
+
+func (f *Hetzner) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "token ausente")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "servers" && r.Method == http.MethodPost:
+		var request struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Name == "" {
+			writeError(w, http.StatusUnprocessableEntity, "invalid_input", "nome obrigatório")
+			return
+		}
+		for _, server := range f.servers {
+			if server.Name == request.Name {
+				writeError(w, http.StatusConflict, "uniqueness_error", "nome já utilizado")
+				return
+			}
+		}
+
+		server := f.addServer(request.Name, "")
+		action := hetznerAction{ID: 100 + server.ID, Status: providers.ActionSuccess, Progress: 100}
+		f.actions[action.ID] = action
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"server": server, "action": action})
+
+	case strings.HasPrefix(path, "actions/") && r.Method == http.MethodGet:
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "actions/"))
+		action, ok := f.actions[id]
+		if err != nil || !ok {
+			writeError(w, http.StatusNotFound, "not_found", "ação não encontrada")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"action": action})
+
+	case path == "servers" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"servers": f.sortedServers()})
+
+	case strings.HasPrefix(path, "servers/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "servers/"))
+		server, ok := f.servers[id]
+		if err != nil || !ok {
+			writeError(w, http.StatusNotFound, "not_found", "servidor não encontrado")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"server": server})
+		case http.MethodDelete:
+			delete(f.servers, id)
+			writeJSON(w, http.StatusOK, map[string]interface{}{})
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", r.Method)
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, "not_found", r.URL.Path)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(payload)
+}
+
+func writeError(w http.ResponseWriter, code int, errCode string, message string) {
+	writeJSON(w, code, map[string]interface{}{"error": hetznerError{Code: errCode, Message: message}})
+}
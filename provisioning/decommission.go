@@ -0,0 +1,295 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/events"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/placement"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/providers"
+	"gorm.io/gorm"
+)
+
+// drainTimeout é quanto tempo o decommission espera as instâncias saírem do
+// servidor (quando não está migrando) antes de falhar.
+const drainTimeout = 24 * time.Hour
+
+// EnqueueDecommission cria um job que remove o servidor: tira-o do placement,
+// espera (ou migra) as instâncias, apaga a máquina no provedor, remove o DNS
+// e por fim apaga o registro. Se já houver um decommission em andamento para
+// o servidor, ele é retornado.
+func EnqueueDecommission(serverID int, migrate bool) (models.ProvisioningJob, error) {
+	var job models.ProvisioningJob
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", enqueueLockKey).Error; err != nil {
+			return err
+		}
+
+		var server models.Server
+		if err := tx.Where("id = ?", serverID).First(&server).Error; err != nil {
+			return err
+		}
+
+		err := tx.Where("kind = ? AND server_id = ? AND state NOT IN ?",
+			models.JobKindDecommission, serverID, models.FinishedJobStates).
+			First(&job).Error
+		if err == nil {
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		job = models.ProvisioningJob{
+			Kind:       models.JobKindDecommission,
+			State:      models.JobRequested,
+			Migrate:    migrate,
+			ServerName: server.Name,
+			Provider:   server.Provider,
+			ProviderID: server.ProviderID,
+			IP:         server.IP,
+			ServerID:   server.ID,
+		}
+		return tx.Create(&job).Error
+	})
+
+	return job, err
+}
+
+// decommissionStep executa a etapa correspondente ao estado atual do job e o
+// move para o próximo estado.
+func decommissionStep(ctx context.Context, job *models.ProvisioningJob) error {
+	switch job.State {
+	case models.JobRequested:
+		return cordon(job)
+	case models.JobCordoned:
+		return drain(ctx, job)
+	case models.JobDrained:
+		return deleteVM(ctx, job)
+	case models.JobVMDeleted:
+		return deleteDNS(ctx, job)
+	case models.JobDNSDeleted:
+		return deleteServer(job)
+	default:
+		return fmt.Errorf("estado desconhecido: %q", job.State)
+	}
+}
+
+func cordon(job *models.ProvisioningJob) error {
+	err := models.DB.Model(&models.Server{}).
+		Where("id = ?", job.ServerID).
+		Update("cordoned", true).Error
+	if err != nil {
+		return err
+	}
+	events.PublishServer(job.ServerID, events.ServerUpdated)
+
+	job.State = models.JobCordoned
+	return nil
+}
+
+func drain(ctx context.Context, job *models.ProvisioningJob) error {
+	var instances []models.Instance
+	if err := models.DB.Where("server_id = ?", job.ServerID).Find(&instances).Error; err != nil {
+		return err
+	}
+
+	// Uma instância em creating ainda está sendo criada por uma requisição
+	// (que reservou a vaga antes do cordon); migrá-la agora a recriaria no
+	// destino enquanto a criação original termina na origem.
+	for _, instance := range instances {
+		if instance.Status == models.StateCreating {
+			if time.Since(job.CreatedAt) > drainTimeout {
+				job.State = models.JobFailed
+				return fmt.Errorf("instância %s ainda em criação após %s", instance.Name, drainTimeout)
+			}
+			return fmt.Errorf("%w: instância %s em criação", errWaiting, instance.Name)
+		}
+	}
+
+	if len(instances) > 0 && job.Migrate {
+		var server models.Server
+		if err := models.DB.Where("id = ?", job.ServerID).First(&server).Error; err != nil {
+			return err
+		}
+
+		for _, instance := range instances {
+			if err := migrateInstance(ctx, server, instance); err != nil {
+				return fmt.Errorf("erro ao migrar a instância %s: %w", instance.Name, err)
+			}
+		}
+		instances = nil
+	}
+
+	if len(instances) > 0 {
+		if time.Since(job.CreatedAt) > drainTimeout {
+			job.State = models.JobFailed
+			return fmt.Errorf("%d instâncias ainda no servidor após %s", len(instances), drainTimeout)
+		}
+		return fmt.Errorf("%w: %d instâncias ainda no servidor", errWaiting, len(instances))
+	}
+
+	job.State = models.JobDrained
+	return nil
+}
+
+// migrateInstance recria a instância em outro servidor e a remove do
+// servidor de origem. A sessão do WhatsApp não é transferida: o número volta
+// como logged_out e precisa ler o QR code de novo. O status é gravado antes
+// de mover a instância, para que uma falha no meio do caminho não deixe o
+// banco dizendo que ela continua conectada; a próxima tentativa encontra a
+// instância já logged_out e refaz só o que falta.
+func migrateInstance(ctx context.Context, source models.Server, instance models.Instance) error {
+	if _, err := models.SetInstanceStatus(models.DB, &instance, models.StateLoggedOut, models.StatusSourceMigrate); err != nil {
+		return err
+	}
+
+	target, err := placement.Relocate(&instance)
+	if err != nil {
+		return err
+	}
+
+	if err := createEvolutionInstance(ctx, target.URL, instance.Name, instance.Apikey); err != nil {
+		// Volta a instância para a origem, onde ela ainda existe, para que
+		// o drain tente de novo.
+		if revertErr := models.DB.Model(&instance).Update("server_id", source.ID).Error; revertErr != nil {
+			return fmt.Errorf("%w (e ao devolver a instância para a origem: %s)", err, revertErr)
+		}
+		return err
+	}
+
+	if err := DeleteEvolutionInstance(ctx, source.URL, instance.Name); err != nil {
+		fmt.Printf("Erro ao remover a instância %s do servidor %s: %s\n", instance.Name, source.Name, err)
+	}
+	return nil
+}
+
+func deleteVM(ctx context.Context, job *models.ProvisioningJob) error {
+	provider, providerID, err := jobMachine(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	if provider != nil {
+		err := provider.DeleteServer(ctx, providerID)
+		if err != nil && !errors.Is(err, providers.ErrNotFound) {
+			return err
+		}
+	}
+
+	job.State = models.JobVMDeleted
+	return nil
+}
+
+// jobMachine retorna o provedor e o id da máquina do servidor. Servidores
+// provisionados antes de o id ser gravado são procurados no provedor padrão
+// pelo nome ou pelo IP; servidores cadastrados manualmente, sem máquina no
+// provedor, retornam provider nil.
+func jobMachine(ctx context.Context, job *models.ProvisioningJob) (providers.Provider, string, error) {
+	if job.Provider != "" && job.ProviderID != "" {
+		provider, err := providerByName(job.Provider)
+		return provider, job.ProviderID, err
+	}
+
+	provider, err := defaultProvider()
+	if err != nil {
+		fmt.Printf("Provedor não configurado; máquina de %s não removida: %s\n", job.ServerName, err)
+		return nil, "", nil
+	}
+
+	machines, err := provider.ListServers(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ip := hostOf(job.IP)
+	for _, machine := range machines {
+		if machine.Name == job.ServerName || (ip != "" && machine.IP == ip) {
+			return provider, machine.ID, nil
+		}
+	}
+
+	fmt.Printf("Máquina de %s não encontrada no provedor %s\n", job.ServerName, provider.Name())
+	return nil, "", nil
+}
+
+func deleteDNS(ctx context.Context, job *models.ProvisioningJob) error {
+	var server models.Server
+	if err := models.DB.Where("id = ?", job.ServerID).First(&server).Error; err != nil {
+		return err
+	}
+
+	dns, err := defaultDNS()
+	if err != nil {
+		if server.DNSRecordID == "" {
+			// Sem registro gravado e sem DNS configurado: servidor
+			// cadastrado manualmente, com DNS fora do manager.
+			fmt.Printf("DNS não configurado; registro de %s não removido: %s\n", server.Name, err)
+			job.State = models.JobDNSDeleted
+			return nil
+		}
+		return err
+	}
+
+	if server.DNSRecordID != "" {
+		err := dns.DeleteRecord(ctx, server.DNSRecordID)
+		if err != nil && !errors.Is(err, providers.ErrNotFound) {
+			return err
+		}
+	} else {
+		// Servidores criados antes de o id do registro ser gravado: o
+		// registro é encontrado pelo nome e só é removido se apontar para o
+		// IP do servidor.
+		records, err := dns.ListRecords(ctx, hostOf(server.URL))
+		if err != nil {
+			return err
+		}
+
+		ip := hostOf(job.IP)
+		for _, record := range records {
+			if ip != "" && record.Content != ip {
+				continue
+			}
+			err := dns.DeleteRecord(ctx, record.ID)
+			if err != nil && !errors.Is(err, providers.ErrNotFound) {
+				return err
+			}
+		}
+	}
+
+	job.State = models.JobDNSDeleted
+	return nil
+}
+
+// hostOf retorna o host de uma URL ou de um IP gravado com esquema e barras
+// (como nos servidores cadastrados antes do provisionamento).
+func hostOf(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	if !strings.Contains(value, "://") {
+		value = "//" + value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+func deleteServer(job *models.ProvisioningJob) error {
+	if err := models.DB.Where("id = ?", job.ServerID).Delete(&models.Server{}).Error; err != nil {
+		return err
+	}
+	events.PublishServer(job.ServerID, events.ServerDeleted)
+
+	job.State = models.JobDone
+	return nil
+}
@@ -0,0 +1,157 @@
+package provisioning
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/remote"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/stacks"
+	"golang.org/x/crypto/ssh"
+)
+
+// remoteDir é onde os arquivos das stacks ficam no servidor.
+const remoteDir = "/root"
+
+// deployStep é um comando executado no servidor. Todos os comandos podem ser
+// repetidos sem efeito colateral, para que um job interrompido seja
+// retomado do início do deploy.
+type deployStep struct {
+	Name    string
+	Command string
+	Stdin   func() (io.Reader, error)
+}
+
+func deploySteps(server models.Server, files []stacks.File) []deployStep {
+	ip := remote.Host(server.IP)
+
+	steps := []deployStep{
+		{
+			Name: "install_docker",
+			Command: `if ! command -v docker >/dev/null 2>&1; then
+	apt-get update -y && curl -fsSL https://get.docker.com -o get-docker.sh && sh get-docker.sh
+fi
+docker --version`,
+		},
+		{
+			Name: "swarm_init",
+			Command: fmt.Sprintf(`if [ "$(docker info --format '{{.Swarm.LocalNodeState}}')" != "active" ]; then
+	docker swarm init --advertise-addr=%s
+fi
+docker info --format '{{.Swarm.LocalNodeState}}'`, ip),
+		},
+		{
+			Name:    "create_network",
+			Command: "docker network inspect evolution_network >/dev/null 2>&1 || docker network create --driver=overlay evolution_network",
+		},
+	}
+
+	for _, file := range files {
+		content := file.Content
+		steps = append(steps, deployStep{
+			Name:    "upload_" + file.Stack,
+			Command: fmt.Sprintf("cat > %s/%s", remoteDir, file.Name),
+			Stdin: func() (io.Reader, error) {
+				return strings.NewReader(content), nil
+			},
+		})
+	}
+
+	for _, file := range files {
+		steps = append(steps, deployStep{
+			Name:    "deploy_" + file.Stack,
+			Command: fmt.Sprintf("docker stack deploy -c %s/%s %s", remoteDir, file.Name, file.Stack),
+		})
+	}
+
+	return steps
+}
+
+// deployStack renderiza as stacks do servidor, instala o Docker, inicia o
+// Swarm e faz o deploy via SSH. A saída de cada etapa é gravada em
+// ProvisioningLog e, no fim, a revisão implantada é gravada no servidor.
+func deployStack(job *models.ProvisioningJob, server *models.Server) error {
+	if err := models.EnsureWebhookToken(models.DB, server); err != nil {
+		return fmt.Errorf("erro ao gerar o token do webhook: %w", err)
+	}
+
+	revision, files, err := stacks.Save(*server, stacks.ParamsFor(*server))
+	if err != nil {
+		return fmt.Errorf("erro ao renderizar as stacks: %w", err)
+	}
+
+	client, err := remote.Dial(server)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, step := range deploySteps(*server, files) {
+		if err := runDeployStep(client, job, step); err != nil {
+			return fmt.Errorf("etapa %s: %w", step.Name, err)
+		}
+	}
+
+	return models.DB.Model(server).Update("stack_revision_id", revision.ID).Error
+}
+
+func runDeployStep(client *ssh.Client, job *models.ProvisioningJob, step deployStep) error {
+	entry := models.ProvisioningLog{
+		JobID:     job.ID,
+		Step:      step.Name,
+		Command:   step.Command,
+		StartedAt: time.Now(),
+	}
+
+	var stdin io.Reader
+	var err error
+	if step.Stdin != nil {
+		stdin, err = step.Stdin()
+	}
+	if err == nil {
+		entry.Output, entry.ExitCode, err = remote.Run(client, step.Command, stdin)
+	}
+
+	entry.FinishedAt = time.Now()
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if saveErr := models.DB.Create(&entry).Error; saveErr != nil {
+		fmt.Println("Erro ao salvar log de provisionamento:", saveErr)
+	}
+
+	return err
+}
+
+// redeployStack envia o arquivo da stack informada, dentre os renderizados
+// por stacks.Save, e roda docker stack deploy de novo. O Swarm só atualiza os
+// serviços que mudaram, com rolling update.
+func redeployStack(server *models.Server, files []stacks.File, stack string) error {
+	var file *stacks.File
+	for i := range files {
+		if files[i].Stack == stack {
+			file = &files[i]
+		}
+	}
+	if file == nil {
+		return fmt.Errorf("stack %s não encontrada", stack)
+	}
+
+	client, err := remote.Dial(server)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	path := fmt.Sprintf("%s/%s", remoteDir, file.Name)
+	if output, _, err := remote.Run(client, "cat > "+path, strings.NewReader(file.Content)); err != nil {
+		return fmt.Errorf("erro ao enviar %s: %w: %s", file.Name, err, output)
+	}
+	if output, _, err := remote.Run(client, fmt.Sprintf("docker stack deploy -c %s %s", path, stack), nil); err != nil {
+		return fmt.Errorf("erro no deploy da stack %s: %w: %s", stack, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package provisioning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+)
+
+var evolutionClient = &http.Client{Timeout: 30 * time.Second}
+
+// evolutionRequest chama a Evolution API de um servidor com a chave global e
+// retorna erro para respostas fora de 2xx (exceto os status em allowed).
+func evolutionRequest(ctx context.Context, method string, serverUrl string, path string, payload interface{}, allowed ...int) error {
+	var body io.Reader
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payloadBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, serverUrl+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
+
+	resp, err := evolutionClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	for _, code := range allowed {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("evolution: %s %s: status %d", method, path, resp.StatusCode)
+}
+
+// createEvolutionInstance cria a instância no servidor com o mesmo nome e
+// token; o número precisa ler o QR code de novo.
+func createEvolutionInstance(ctx context.Context, serverUrl string, name string, token string) error {
+	payload := map[string]interface{}{
+		"instanceName": name,
+		"token":        token,
+		"qrcode":       false,
+	}
+	return evolutionRequest(ctx, http.MethodPost, serverUrl, "/instance/create", payload)
+}
+
+// DeleteEvolutionInstance desconecta e remove a instância do servidor,
+// ignorando instâncias que já não existem. É usado também pelo reparo de
+// órfãos da reconciliação.
+func DeleteEvolutionInstance(ctx context.Context, serverUrl string, name string) error {
+	escaped := url.PathEscape(name)
+
+	err := evolutionRequest(ctx, http.MethodDelete, serverUrl, "/instance/logout/"+escaped, nil,
+		http.StatusBadRequest, http.StatusNotFound)
+	if err != nil {
+		return err
+	}
+
+	return evolutionRequest(ctx, http.MethodDelete, serverUrl, "/instance/delete/"+escaped, nil, http.StatusNotFound)
+}
+
+// evolutionVersion retorna a versão reportada pela rota raiz da Evolution API.
+func evolutionVersion(ctx context.Context, serverUrl string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverUrl+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
+
+	resp, err := evolutionClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Version == "" {
+		return "", fmt.Errorf("evolution: versão não informada (status %d)", resp.StatusCode)
+	}
+	return body.Version, nil
+}
+
+// recordEvolutionVersion grava a imagem e a versão que o servidor está
+// rodando. Falhar ao obter a versão não impede o registro da imagem.
+func recordEvolutionVersion(ctx context.Context, server *models.Server, image string) error {
+	version, err := evolutionVersion(ctx, server.URL)
+	if err != nil {
+		fmt.Printf("Erro ao obter a versão da Evolution em %s: %s\n", server.Name, err)
+	}
+
+	return models.DB.Model(server).Updates(map[string]interface{}{
+		"evolution_image":   image,
+		"evolution_version": version,
+	}).Error
+}
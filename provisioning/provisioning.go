@@ -0,0 +1,339 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/events"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/leader"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/providers"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/stacks"
+	"gorm.io/gorm"
+)
+
+// enqueueLockKey serializa a criação de jobs entre réplicas do manager.
+const enqueueLockKey = 0x77736d02
+
+// maxAttempts é quantas vezes uma etapa é tentada antes de o job falhar.
+const maxAttempts = 5
+
+// pollInterval é o intervalo entre as varreduras do worker.
+const pollInterval = 10 * time.Second
+
+// Provedores usados pelos jobs; trocados nos testes.
+var (
+	defaultProvider = providers.Default
+	defaultDNS      = providers.DefaultDNS
+	providerByName  = providers.New
+)
+
+// Enqueue cria um job de provisionamento, a menos que já exista um em
+// andamento; nesse caso o job existente é retornado.
+func Enqueue() (models.ProvisioningJob, error) {
+	var job models.ProvisioningJob
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", enqueueLockKey).Error; err != nil {
+			return err
+		}
+
+		err := tx.Where("kind = ? AND state NOT IN ?", models.JobKindProvision, models.FinishedJobStates).
+			Order("id").
+			First(&job).Error
+		if err == nil {
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		job = models.ProvisioningJob{
+			Kind:       models.JobKindProvision,
+			State:      models.JobRequested,
+			ServerName: fmt.Sprintf("eapi%s", time.Now().Format("20060102150405")),
+		}
+		return tx.Create(&job).Error
+	})
+
+	return job, err
+}
+
+// Run executa o worker de jobs até o contexto ser cancelado. Jobs que
+// ficaram pela metade (por exemplo, porque o processo reiniciou) são
+// retomados na primeira varredura.
+func Run(ctx context.Context) {
+	runWorker(ctx, ProcessPending)
+}
+
+// RunUpgrades executa o worker de upgrades da frota até o contexto ser
+// cancelado. Fica separado de Run porque um upgrade leva minutos por
+// servidor, e os jobs de provisionamento não podem esperar por ele (nem ele
+// pelos jobs).
+func RunUpgrades(ctx context.Context) {
+	runWorker(ctx, ProcessUpgrades)
+}
+
+func runWorker(ctx context.Context, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		fn(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessPending avança todos os jobs que ainda não terminaram.
+func ProcessPending(ctx context.Context) {
+	var jobs []models.ProvisioningJob
+
+	err := models.DB.Where("state NOT IN ?", models.FinishedJobStates).
+		Order("id").
+		Find(&jobs).Error
+	if err != nil {
+		fmt.Println("Erro ao buscar jobs de provisionamento:", err)
+		return
+	}
+
+	for _, job := range jobs {
+		process(ctx, job)
+	}
+}
+
+// errWaiting indica que a etapa ainda depende de algo externo (por exemplo,
+// instâncias saindo do servidor). Não conta como tentativa.
+var errWaiting = errors.New("aguardando")
+
+// process executa as etapas do job até ele terminar ou uma etapa falhar.
+// Uma etapa que falha é tentada de novo na próxima varredura, até
+// maxAttempts; depois disso o job vai para failed. Antes de cada etapa e de
+// cada gravação a liderança é confirmada (ver leader.Fence): uma réplica que
+// perdeu o lock não executa nem grava por cima da nova líder.
+func process(ctx context.Context, job models.ProvisioningJob) {
+	for !job.Finished() {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := leader.Fence(ctx); err != nil {
+			fmt.Printf("Job de provisionamento %d interrompido: %s\n", job.ID, err)
+			return
+		}
+
+		var err error
+		if job.Kind == models.JobKindDecommission {
+			err = decommissionStep(ctx, &job)
+		} else {
+			err = provisionStep(ctx, &job)
+		}
+
+		if errors.Is(err, errWaiting) {
+			job.Error = err.Error()
+		} else if err != nil {
+			job.Attempts++
+			job.Error = err.Error()
+			if job.Attempts >= maxAttempts {
+				job.State = models.JobFailed
+			}
+			fmt.Printf("Erro no job de provisionamento %d (%s): %s\n", job.ID, job.State, err)
+		} else {
+			job.Attempts = 0
+			job.Error = ""
+		}
+
+		if fenceErr := leader.Fence(ctx); fenceErr != nil {
+			fmt.Printf("Job de provisionamento %d não gravado: %s\n", job.ID, fenceErr)
+			return
+		}
+		if saveErr := models.DB.Save(&job).Error; saveErr != nil {
+			fmt.Println("Erro ao salvar job de provisionamento:", saveErr)
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// provisionStep executa a etapa correspondente ao estado atual do job e o
+// move para o próximo estado.
+func provisionStep(ctx context.Context, job *models.ProvisioningJob) error {
+	switch job.State {
+	case models.JobRequested:
+		return createVM(ctx, job)
+	case models.JobVMCreated:
+		return createDNS(ctx, job)
+	case models.JobDNSCreated:
+		job.State = models.JobDeploying
+		return nil
+	case models.JobDeploying:
+		return deploy(ctx, job)
+	default:
+		return fmt.Errorf("estado desconhecido: %q", job.State)
+	}
+}
+
+func createVM(ctx context.Context, job *models.ProvisioningJob) error {
+	provider, err := defaultProvider()
+	if err != nil {
+		return err
+	}
+
+	// Se o processo caiu entre a criação da máquina e o Save do job, a
+	// máquina já existe no provedor e não deve ser criada de novo.
+	machines, err := provider.ListServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	var machine providers.Machine
+	found := false
+	for _, m := range machines {
+		if m.Name == job.ServerName {
+			machine = m
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		machine, err = provider.CreateServer(ctx, job.ServerName)
+		if err != nil {
+			return err
+		}
+	}
+
+	job.Provider = provider.Name()
+	job.ProviderID = machine.ID
+	job.ActionID = machine.ActionID
+	job.IP = machine.IP
+	job.State = models.JobVMCreated
+	return nil
+}
+
+func createDNS(ctx context.Context, job *models.ProvisioningJob) error {
+	domain := serverDomain(job.ServerName)
+
+	record, err := ensureDNSRecord(ctx, domain, job.IP)
+	if err != nil {
+		return err
+	}
+
+	// O servidor é gravado cordoned: só entra no placement quando o deploy
+	// terminar.
+	var server models.Server
+	err = models.DB.Where("name = ?", job.ServerName).First(&server).Error
+	if err == gorm.ErrRecordNotFound {
+		server = models.Server{
+			Name:        job.ServerName,
+			IP:          job.IP,
+			CreatedAt:   time.Now(),
+			URL:         "http://" + domain + ":8080",
+			Cordoned:    true,
+			Provider:    job.Provider,
+			ProviderID:  job.ProviderID,
+			DNSRecordID: record.ID,
+		}
+		err = models.DB.Create(&server).Error
+		if err == nil {
+			events.PublishServer(server.ID, events.ServerCreated)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	job.ServerID = server.ID
+	job.State = models.JobDNSCreated
+	return nil
+}
+
+// ensureDNSRecord cria o registro A do servidor, ou reaproveita (e corrige) um
+// registro com o mesmo nome criado por uma tentativa anterior.
+func ensureDNSRecord(ctx context.Context, name string, ip string) (providers.DNSRecord, error) {
+	dns, err := defaultDNS()
+	if err != nil {
+		return providers.DNSRecord{}, err
+	}
+
+	records, err := dns.ListRecords(ctx, name)
+	if err != nil {
+		return providers.DNSRecord{}, err
+	}
+
+	for _, record := range records {
+		if record.Type != "A" {
+			continue
+		}
+		if record.Content == ip {
+			return record, nil
+		}
+		record.Content = ip
+		return dns.UpdateRecord(ctx, record)
+	}
+
+	return dns.CreateRecord(ctx, providers.DNSRecord{
+		Type:    "A",
+		Name:    name,
+		Content: ip,
+		TTL:     120,
+	})
+}
+
+// deploy espera a máquina ficar acessível, instala a stack e só libera o
+// servidor para o placement quando a Evolution responder.
+func deploy(ctx context.Context, job *models.ProvisioningJob) error {
+	provider, err := defaultProvider()
+	if err != nil {
+		return err
+	}
+
+	var server models.Server
+	if err := models.DB.Where("id = ?", job.ServerID).First(&server).Error; err != nil {
+		return err
+	}
+
+	if err := waitForMachine(ctx, provider, job); err != nil {
+		return err
+	}
+	if err := waitForSSH(ctx, job.IP); err != nil {
+		return err
+	}
+	if err := deployStack(job, &server); err != nil {
+		return err
+	}
+	if err := waitForEvolution(ctx, server.URL); err != nil {
+		return err
+	}
+	if err := recordEvolutionVersion(ctx, &server, stacks.ParamsFor(server).EvolutionImage); err != nil {
+		return err
+	}
+
+	err = models.DB.Model(&server).Update("cordoned", false).Error
+	if err != nil {
+		return err
+	}
+	events.PublishServer(server.ID, events.ServerUpdated)
+
+	job.State = models.JobReady
+	return nil
+}
+
+// serverDomain monta o domínio do servidor a partir de SERVER_DOMAIN
+// (shub.tech por padrão).
+func serverDomain(name string) string {
+	domain := os.Getenv("SERVER_DOMAIN")
+	if domain == "" {
+		domain = "shub.tech"
+	}
+	return name + "." + domain
+}
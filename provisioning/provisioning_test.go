@@ -0,0 +1,224 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models/modelstest"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/providers"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/providers/providertest"
+)
+
+// useFakeProviders troca os provedores dos jobs pelo fake da Hetzner e por
+// um DNS em memória até o fim do teste.
+func useFakeProviders(t *testing.T) (*providertest.Hetzner, *providers.MemoryDNS) {
+	t.Helper()
+
+	fake := providertest.NewHetzner(t)
+	dns := providers.NewMemoryDNS()
+
+	previousProvider, previousDNS, previousByName := defaultProvider, defaultDNS, providerByName
+	defaultProvider = func() (providers.Provider, error) {
+		return fake.Provider(), nil
+	}
+	defaultDNS = func() (providers.DNSProvider, error) {
+		return dns, nil
+	}
+	providerByName = func(name string) (providers.Provider, error) {
+		if name != "hetzner" {
+			return nil, fmt.Errorf("provedor desconhecido: %s", name)
+		}
+		return fake.Provider(), nil
+	}
+	t.Cleanup(func() {
+		defaultProvider, defaultDNS, providerByName = previousProvider, previousDNS, previousByName
+	})
+
+	return fake, dns
+}
+
+// runSteps executa step até o job chegar em want, gravando o job a cada
+// etapa quando save é true, como o worker faz.
+func runSteps(t *testing.T, job *models.ProvisioningJob, want string, save bool,
+	step func(ctx context.Context, job *models.ProvisioningJob) error) {
+	t.Helper()
+
+	var states []string
+	for i := 0; job.State != want; i++ {
+		if i == 10 {
+			t.Fatalf("job não chegou em %s; estados: %v", want, states)
+		}
+		if err := step(context.Background(), job); err != nil {
+			t.Fatalf("etapa %s: %v", job.State, err)
+		}
+		states = append(states, job.State)
+		if save {
+			if err := models.DB.Save(job).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestCreateVM(t *testing.T) {
+	fake, _ := useFakeProviders(t)
+
+	job := models.ProvisioningJob{Kind: models.JobKindProvision, State: models.JobRequested, ServerName: "eapi-test"}
+	runSteps(t, &job, models.JobVMCreated, false, provisionStep)
+
+	machines := fake.Machines()
+	if len(machines) != 1 {
+		t.Fatalf("%d máquinas no provedor, want 1", len(machines))
+	}
+	if job.Provider != "hetzner" || job.ProviderID != machines[0].ID || job.IP != machines[0].IP || job.ActionID == "" {
+		t.Errorf("job = %+v, máquina = %+v", job, machines[0])
+	}
+
+	// O processo caiu antes do Save: a etapa roda de novo e reaproveita a
+	// máquina em vez de criar outra.
+	retry := models.ProvisioningJob{Kind: models.JobKindProvision, State: models.JobRequested, ServerName: "eapi-test"}
+	runSteps(t, &retry, models.JobVMCreated, false, provisionStep)
+
+	if machines := fake.Machines(); len(machines) != 1 {
+		t.Errorf("%d máquinas depois da nova tentativa, want 1", len(machines))
+	}
+	if retry.ProviderID != job.ProviderID {
+		t.Errorf("ProviderID = %q na nova tentativa, want %q", retry.ProviderID, job.ProviderID)
+	}
+}
+
+func TestWaitForMachine(t *testing.T) {
+	fake, _ := useFakeProviders(t)
+	ctx := context.Background()
+
+	job := models.ProvisioningJob{Kind: models.JobKindProvision, State: models.JobRequested, ServerName: "eapi-test"}
+	runSteps(t, &job, models.JobVMCreated, false, provisionStep)
+
+	provider := fake.Provider()
+	if err := waitForMachine(ctx, provider, &job); err != nil {
+		t.Fatalf("waitForMachine() com a ação concluída: %v", err)
+	}
+
+	fake.SetAction(job.ActionID, providers.ActionError, "sem capacidade")
+	if err := waitForMachine(ctx, provider, &job); !errors.Is(err, errActionFailed) {
+		t.Errorf("waitForMachine() com a ação falha: err = %v, want errActionFailed", err)
+	}
+
+	// Máquina reaproveitada, sem ação: vale o status da máquina.
+	job.ActionID = ""
+	if err := waitForMachine(ctx, provider, &job); err != nil {
+		t.Errorf("waitForMachine() sem ação: %v", err)
+	}
+}
+
+func TestDeleteVM(t *testing.T) {
+	tests := []struct {
+		name string
+		job  func(machine providers.Machine) models.ProvisioningJob
+		// deleted indica se a máquina cadastrada deve ser removida.
+		deleted bool
+	}{
+		{
+			name: "id gravado",
+			job: func(machine providers.Machine) models.ProvisioningJob {
+				return models.ProvisioningJob{ServerName: machine.Name, Provider: "hetzner", ProviderID: machine.ID}
+			},
+			deleted: true,
+		},
+		{
+			name: "servidor antigo encontrado pelo nome",
+			job: func(machine providers.Machine) models.ProvisioningJob {
+				return models.ProvisioningJob{ServerName: machine.Name}
+			},
+			deleted: true,
+		},
+		{
+			name: "servidor antigo encontrado pelo IP",
+			job: func(machine providers.Machine) models.ProvisioningJob {
+				return models.ProvisioningJob{ServerName: "primeiro servidor", IP: "http://" + machine.IP + "/"}
+			},
+			deleted: true,
+		},
+		{
+			name: "servidor sem máquina no provedor",
+			job: func(machine providers.Machine) models.ProvisioningJob {
+				return models.ProvisioningJob{ServerName: "manual", IP: "http://192.0.2.1/"}
+			},
+			deleted: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, _ := useFakeProviders(t)
+			machine := fake.AddMachine("eapi-antigo", "198.51.100.7")
+
+			job := tt.job(machine)
+			job.Kind = models.JobKindDecommission
+			job.State = models.JobDrained
+			runSteps(t, &job, models.JobVMDeleted, false, decommissionStep)
+
+			remaining := len(fake.Machines())
+			if tt.deleted && remaining != 0 {
+				t.Errorf("máquina não removida")
+			}
+			if !tt.deleted && remaining != 1 {
+				t.Errorf("máquina removida sem pertencer ao servidor")
+			}
+		})
+	}
+}
+
+// TestProvisionAndDecommission leva um job de provisionamento até o deploy
+// (que precisa de SSH e fica de fora) e depois remove o servidor criado.
+func TestProvisionAndDecommission(t *testing.T) {
+	modelstest.Setup(t)
+	fake, dns := useFakeProviders(t)
+	ctx := context.Background()
+
+	job, err := Enqueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runSteps(t, &job, models.JobDeploying, true, provisionStep)
+
+	var server models.Server
+	if err := models.DB.Where("id = ?", job.ServerID).First(&server).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !server.Cordoned || server.ProviderID != job.ProviderID || server.DNSRecordID == "" {
+		t.Errorf("servidor = %+v", server)
+	}
+
+	domain := serverDomain(job.ServerName)
+	records, err := dns.ListRecords(ctx, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != server.DNSRecordID || records[0].Content != job.IP {
+		t.Errorf("registros de %s = %+v", domain, records)
+	}
+
+	decommission, err := EnqueueDecommission(server.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runSteps(t, &decommission, models.JobDone, true, decommissionStep)
+
+	if machines := fake.Machines(); len(machines) != 0 {
+		t.Errorf("máquinas no provedor depois do decommission: %+v", machines)
+	}
+	if records, err := dns.ListRecords(ctx, domain); err != nil || len(records) != 0 {
+		t.Errorf("registros depois do decommission: %+v (err = %v)", records, err)
+	}
+	var count int64
+	if err := models.DB.Model(&models.Server{}).Where("id = ?", server.ID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Error("servidor continua cadastrado")
+	}
+}
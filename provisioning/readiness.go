@@ -0,0 +1,131 @@
+package provisioning
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/providers"
+)
+
+const (
+	readinessInterval = 5 * time.Second
+	machineTimeout    = 5 * time.Minute
+	sshTimeout        = 5 * time.Minute
+	evolutionTimeout  = 10 * time.Minute
+)
+
+// errActionFailed indica que a ação do provedor terminou com erro; não
+// adianta continuar esperando.
+var errActionFailed = errors.New("ação do provedor falhou")
+
+// poll chama check a cada intervalo até ele não retornar erro ou o tempo
+// acabar; nesse caso retorna o último erro. errActionFailed encerra a espera
+// na hora.
+func poll(ctx context.Context, what string, timeout time.Duration, check func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		err := check(ctx)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, errActionFailed) {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s não ficou pronto em %s: %w", what, timeout, err)
+		case <-time.After(readinessInterval):
+		}
+	}
+}
+
+// waitForMachine espera a ação de criação da máquina terminar no provedor.
+// Jobs sem a ação (máquina reaproveitada de uma tentativa anterior) esperam
+// o provedor reportar a máquina como running.
+func waitForMachine(ctx context.Context, provider providers.Provider, job *models.ProvisioningJob) error {
+	if job.ActionID != "" {
+		return poll(ctx, "máquina", machineTimeout, func(ctx context.Context) error {
+			action, err := provider.GetAction(ctx, job.ActionID)
+			if err != nil {
+				return err
+			}
+			switch action.Status {
+			case providers.ActionSuccess:
+				return nil
+			case providers.ActionError:
+				return fmt.Errorf("%w: %s", errActionFailed, action.Error)
+			default:
+				return fmt.Errorf("ação %s em %d%%", action.Status, action.Progress)
+			}
+		})
+	}
+
+	return poll(ctx, "máquina", machineTimeout, func(ctx context.Context) error {
+		machine, err := provider.GetServer(ctx, job.ProviderID)
+		if err != nil {
+			return err
+		}
+		if machine.Status != "running" {
+			return fmt.Errorf("status %q", machine.Status)
+		}
+		return nil
+	})
+}
+
+// waitForSSH espera o sshd da máquina responder com o banner do protocolo.
+func waitForSSH(ctx context.Context, ip string) error {
+	return poll(ctx, "ssh", sshTimeout, func(ctx context.Context) error {
+		dialer := net.Dialer{Timeout: readinessInterval}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, "22"))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(readinessInterval))
+		banner, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(banner, "SSH-") {
+			return fmt.Errorf("banner inesperado: %q", banner)
+		}
+		return nil
+	})
+}
+
+// waitForEvolution espera a Evolution API responder /instance/fetchInstances
+// com a chave configurada em EVOLUTION_APIKEY.
+func waitForEvolution(ctx context.Context, serverUrl string) error {
+	client := &http.Client{Timeout: readinessInterval}
+
+	return poll(ctx, "evolution", evolutionTimeout, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverUrl+"/instance/fetchInstances", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("apikey", os.Getenv("EVOLUTION_APIKEY"))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,218 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/leader"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/stacks"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/swarm"
+	"gorm.io/gorm"
+)
+
+// convergeTimeout é quanto tempo o Swarm tem para terminar o rolling update
+// de um servidor.
+const convergeTimeout = 10 * time.Minute
+
+// ErrUpgradeInProgress indica que já existe um upgrade rodando ou pausado.
+var ErrUpgradeInProgress = errors.New("já existe um upgrade em andamento")
+
+// StartUpgrade cria um upgrade da frota para a imagem informada. Com image
+// vazia cada servidor mantém a imagem atual e só o ambiente da stack é
+// reimplantado (token e URL do webhook, chave etc.). Só pode haver um
+// upgrade rodando ou pausado por vez.
+func StartUpgrade(image string) (models.FleetUpgrade, error) {
+	var upgrade models.FleetUpgrade
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", enqueueLockKey).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		err := tx.Model(&models.FleetUpgrade{}).
+			Where("state IN ?", []string{models.UpgradeRunning, models.UpgradePaused}).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUpgradeInProgress
+		}
+
+		upgrade = models.FleetUpgrade{Image: image, State: models.UpgradeRunning}
+		return tx.Create(&upgrade).Error
+	})
+
+	return upgrade, err
+}
+
+// ResumeUpgrade retoma um upgrade pausado a partir do servidor que falhou.
+func ResumeUpgrade(id int) (models.FleetUpgrade, error) {
+	var upgrade models.FleetUpgrade
+	if err := models.DB.Where("id = ?", id).First(&upgrade).Error; err != nil {
+		return upgrade, err
+	}
+
+	if upgrade.State != models.UpgradePaused {
+		return upgrade, fmt.Errorf("upgrade está %s, não pausado", upgrade.State)
+	}
+
+	upgrade.State = models.UpgradeRunning
+	upgrade.Error = ""
+	err := models.DB.Save(&upgrade).Error
+	return upgrade, err
+}
+
+// ProcessUpgrades avança os upgrades que estão rodando.
+func ProcessUpgrades(ctx context.Context) {
+	var upgrades []models.FleetUpgrade
+
+	err := models.DB.Where("state = ?", models.UpgradeRunning).Order("id").Find(&upgrades).Error
+	if err != nil {
+		fmt.Println("Erro ao buscar upgrades:", err)
+		return
+	}
+
+	for _, upgrade := range upgrades {
+		upgradeFleet(ctx, upgrade)
+	}
+}
+
+// upgradeFleet atualiza os servidores um a um, na ordem do id, incluindo os
+// cordoned (que continuam atendendo as instâncias que já têm) e os
+// cadastrados antes das stacks versionadas. Os que skipUpgrade recusa ficam
+// em SkippedServerIDs. Um servidor que falha pausa o upgrade; os seguintes não
+// são tocados.
+func upgradeFleet(ctx context.Context, upgrade models.FleetUpgrade) {
+	for ctx.Err() == nil {
+		if err := leader.Fence(ctx); err != nil {
+			fmt.Printf("Upgrade %d interrompido: %s\n", upgrade.ID, err)
+			return
+		}
+
+		var server models.Server
+		err := models.DB.Where("id > ?", upgrade.LastServerID).
+			Order("id").
+			First(&server).Error
+		if err == gorm.ErrRecordNotFound {
+			upgrade.State = models.UpgradeCompleted
+			upgrade.CurrentServerID = 0
+			saveUpgrade(&upgrade)
+			return
+		}
+		if err != nil {
+			fmt.Println("Erro ao buscar o próximo servidor do upgrade:", err)
+			return
+		}
+
+		skip, err := skipUpgrade(server)
+		if err != nil {
+			fmt.Println("Erro ao verificar o servidor do upgrade:", err)
+			return
+		}
+		if skip {
+			upgrade.SkippedServerIDs = append(upgrade.SkippedServerIDs, server.ID)
+			upgrade.LastServerID = server.ID
+			if !saveUpgrade(&upgrade) {
+				return
+			}
+			continue
+		}
+
+		upgrade.CurrentServerID = server.ID
+		if !saveUpgrade(&upgrade) {
+			return
+		}
+
+		err = upgradeServer(ctx, &server, upgrade.Image)
+		if fenceErr := leader.Fence(ctx); fenceErr != nil {
+			fmt.Printf("Upgrade %d não gravado: %s\n", upgrade.ID, fenceErr)
+			return
+		}
+		if err != nil {
+			upgrade.State = models.UpgradePaused
+			upgrade.Error = fmt.Sprintf("servidor %s: %s", server.Name, err)
+			fmt.Printf("Upgrade %d pausado: %s\n", upgrade.ID, upgrade.Error)
+			saveUpgrade(&upgrade)
+			return
+		}
+
+		upgrade.LastServerID = server.ID
+		if !saveUpgrade(&upgrade) {
+			return
+		}
+	}
+}
+
+// skipUpgrade informa se o servidor fica fora do upgrade: sem IP para o
+// acesso SSH, ou com provisionamento (que faz o próprio deploy) ou
+// decommission em andamento.
+func skipUpgrade(server models.Server) (bool, error) {
+	if server.IP == "" {
+		return true, nil
+	}
+
+	var count int64
+	err := models.DB.Model(&models.ProvisioningJob{}).
+		Where("server_id = ? AND state NOT IN ?", server.ID, models.FinishedJobStates).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// upgradeServer implanta de novo a stack da Evolution no servidor com a nova
+// imagem (ou a atual, se image for vazia) e o ambiente atual (chave, webhook
+// etc.), espera o Swarm convergir e a API responder, e grava a nova revisão
+// e a versão. O token do webhook é gerado aqui para servidores cadastrados
+// antes dele.
+func upgradeServer(ctx context.Context, server *models.Server, image string) error {
+	if err := models.EnsureWebhookToken(models.DB, server); err != nil {
+		return fmt.Errorf("erro ao gerar o token do webhook: %w", err)
+	}
+
+	params := stacks.ParamsFor(*server)
+	if image != "" {
+		params.EvolutionImage = image
+	}
+	revision, files, err := stacks.Save(*server, params)
+	if err != nil {
+		return err
+	}
+
+	if err := redeployStack(server, files, "evolution"); err != nil {
+		return err
+	}
+
+	client, err := swarm.Connect(server)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	convergeCtx, cancel := context.WithTimeout(ctx, convergeTimeout)
+	defer cancel()
+	if err := client.WaitConverged(convergeCtx, "evolution", "evolution_api", readinessInterval); err != nil {
+		return err
+	}
+
+	if err := waitForEvolution(ctx, server.URL); err != nil {
+		return err
+	}
+
+	if err := models.DB.Model(server).Update("stack_revision_id", revision.ID).Error; err != nil {
+		return err
+	}
+
+	return recordEvolutionVersion(ctx, server, params.EvolutionImage)
+}
+
+func saveUpgrade(upgrade *models.FleetUpgrade) bool {
+	if err := models.DB.Save(upgrade).Error; err != nil {
+		fmt.Println("Erro ao salvar upgrade:", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// maxOutput limita quanto da saída de um comando é guardado.
+const maxOutput = 64 * 1024
+
+// ErrHostKeyMismatch indica que a chave apresentada pelo servidor não é a
+// que foi gravada na primeira conexão.
+var ErrHostKeyMismatch = errors.New("chave de host diferente da registrada para o servidor")
+
+// Dial abre uma conexão SSH com o servidor usando a chave em
+// SSH_PRIVATE_KEY_PATH (/root/.ssh/id_rsa por padrão). A chave de host é
+// gravada em models.Server na primeira conexão e exigida nas seguintes.
+func Dial(server *models.Server) (*ssh.Client, error) {
+	keyPath := os.Getenv("SSH_PRIVATE_KEY_PATH")
+	if keyPath == "" {
+		keyPath = "/root/.ssh/id_rsa"
+	}
+
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler a chave ssh: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao carregar a chave ssh: %w", err)
+	}
+
+	user := os.Getenv("SSH_USER")
+	if user == "" {
+		user = "root"
+	}
+
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: pinnedHostKey(server),
+		Timeout:         15 * time.Second,
+	}
+
+	return ssh.Dial("tcp", net.JoinHostPort(Host(server.IP), "22"), config)
+}
+
+// Host normaliza o IP gravado no servidor, que em registros antigos pode vir
+// como URL (ex.: "http://5.161.71.166/").
+func Host(ip string) string {
+	if parsed, err := url.Parse(ip); err == nil && parsed.Host != "" {
+		return parsed.Hostname()
+	}
+	return strings.Trim(ip, "/")
+}
+
+func pinnedHostKey(server *models.Server) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+
+		if server.SSHHostKey == "" {
+			err := models.DB.Model(server).Update("ssh_host_key", presented).Error
+			if err != nil {
+				return fmt.Errorf("erro ao registrar a chave de host: %w", err)
+			}
+			return nil
+		}
+
+		if server.SSHHostKey != presented {
+			return fmt.Errorf("%w (%s)", ErrHostKeyMismatch, hostname)
+		}
+		return nil
+	}
+}
+
+// Run executa o comando na máquina e retorna a saída combinada (stdout e
+// stderr) e o código de saída. stdin pode ser nil.
+func Run(client *ssh.Client, command string, stdin io.Reader) (string, int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", -1, err
+	}
+	defer session.Close()
+
+	var output limitedBuffer
+	session.Stdout = &output
+	session.Stderr = &output
+	session.Stdin = stdin
+
+	err = session.Run(command)
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return output.String(), exitErr.ExitStatus(), fmt.Errorf("comando terminou com código %d", exitErr.ExitStatus())
+	}
+	if err != nil {
+		return output.String(), -1, err
+	}
+	return output.String(), 0, nil
+}
+
+// limitedBuffer guarda apenas os últimos maxOutput bytes escritos.
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n, err := b.Buffer.Write(p)
+	if b.Len() > maxOutput {
+		b.Next(b.Len() - maxOutput)
+	}
+	return n, err
+}
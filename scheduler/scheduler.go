@@ -0,0 +1,29 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Every executa fn a cada interval até ctx ser cancelado, começando no
+// próximo múltiplo de interval (ex.: na virada do minuto, como o cron fazia).
+// As execuções nunca se sobrepõem: se uma demorar mais que interval, os
+// horários perdidos são pulados e a próxima começa no horário seguinte.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context)) {
+	for {
+		next := time.Now().Truncate(interval).Add(interval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		start := time.Now()
+		fn(ctx)
+		if elapsed := time.Since(start); elapsed > interval {
+			fmt.Printf("Tarefa %s levou %s (intervalo de %s); execuções puladas\n", name, elapsed, interval)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package stacks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"gorm.io/gorm"
+)
+
+// redacted substitui os segredos nos arquivos gravados.
+const redacted = "[REDACTED]"
+
+// secrets localizam os segredos nos arquivos renderizados: a API key da
+// Evolution e o token no caminho do webhook do manager.
+var secrets = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?m)^(\s*AUTHENTICATION_API_KEY:[ \t]*).*$`), `${1}"` + redacted + `"`},
+	{regexp.MustCompile(`(WEBHOOK_GLOBAL_URL:[ \t]*"?[^\s"]*/webhooks/evolution/)[^\s"]+`), `${1}` + redacted},
+}
+
+// redact retorna uma cópia dos arquivos sem os segredos.
+func redact(rendered []File) []File {
+	result := make([]File, len(rendered))
+	for i, file := range rendered {
+		for _, secret := range secrets {
+			file.Content = secret.pattern.ReplaceAllString(file.Content, secret.replacement)
+		}
+		result[i] = file
+	}
+	return result
+}
+
+// encode serializa os arquivos como são gravados na revisão e calcula o
+// hash do conteúdo.
+func encode(rendered []File) (string, string, error) {
+	content, err := json.Marshal(rendered)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256(content)
+	return string(content), hex.EncodeToString(sum[:]), nil
+}
+
+// RedactRevisions remove os segredos das revisões gravadas antes de Save
+// passar a fazê-lo, recalculando o hash.
+func RedactRevisions(db *gorm.DB) error {
+	var revisions []models.StackRevision
+	return db.FindInBatches(&revisions, 100, func(tx *gorm.DB, batch int) error {
+		for _, revision := range revisions {
+			var rendered []File
+			if err := json.Unmarshal([]byte(revision.Files), &rendered); err != nil {
+				return err
+			}
+
+			content, hash, err := encode(redact(rendered))
+			if err != nil {
+				return err
+			}
+			if content == revision.Files {
+				continue
+			}
+
+			err = db.Model(&models.StackRevision{}).
+				Where("id = ?", revision.ID).
+				Updates(map[string]interface{}{"files": content, "hash": hash}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
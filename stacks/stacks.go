@@ -0,0 +1,161 @@
+package stacks
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"gorm.io/gorm"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+var templates = template.Must(
+	template.New("").
+		Funcs(template.FuncMap{"quote": quote}).
+		ParseFS(templateFiles, "templates/*.tmpl"),
+)
+
+// File é um arquivo de stack renderizado e o nome da stack em que ele é
+// implantado.
+type File struct {
+	Name    string `json:"name"`
+	Stack   string `json:"stack"`
+	Content string `json:"content"`
+}
+
+// files lista os templates na ordem de deploy. O volume usado pelo mongo é
+// criado pela stack do portainer.
+var files = []struct {
+	Name  string
+	Stack string
+}{
+	{"global_portainer.yaml", "portainer"},
+	{"rep_mongo.yaml", "postgres"},
+	{"rep_evolution_api.yaml", "evolution"},
+}
+
+// Params são os valores usados para renderizar as stacks de um servidor.
+type Params struct {
+	APIKey          string `json:"-"`
+	ServerURL       string `json:"server_url"`
+	EvolutionImage  string `json:"evolution_image"`
+	EvolutionCPUs   string `json:"evolution_cpus"`
+	EvolutionMemory string `json:"evolution_memory"`
+	MongoImage      string `json:"mongo_image"`
+	MongoCPUs       string `json:"mongo_cpus"`
+	MongoMemory     string `json:"mongo_memory"`
+	WebhookURL      string `json:"-"`
+}
+
+// ParamsFor monta os parâmetros do servidor a partir do ambiente:
+// EVOLUTION_APIKEY, EVOLUTION_IMAGE, EVOLUTION_CPUS, EVOLUTION_MEMORY,
+// MONGO_IMAGE, MONGO_CPUS, MONGO_MEMORY e MANAGER_URL (base do webhook que a
+// Evolution usa para avisar o manager; sem ela, ou sem o WebhookToken do
+// servidor, o webhook fica desligado).
+// Servidores que já passaram por upgrade mantêm a imagem em EvolutionImage.
+func ParamsFor(server models.Server) Params {
+	params := Params{
+		APIKey:          os.Getenv("EVOLUTION_APIKEY"),
+		ServerURL:       server.URL,
+		EvolutionImage:  envOrDefault("EVOLUTION_IMAGE", "davidsongomes/evolution-api:latest"),
+		EvolutionCPUs:   envOrDefault("EVOLUTION_CPUS", "1"),
+		EvolutionMemory: envOrDefault("EVOLUTION_MEMORY", "1000M"),
+		MongoImage:      envOrDefault("MONGO_IMAGE", "mongo:7.0.5"),
+		MongoCPUs:       envOrDefault("MONGO_CPUS", "0.5"),
+		MongoMemory:     envOrDefault("MONGO_MEMORY", "512M"),
+	}
+
+	if server.EvolutionImage != "" {
+		params.EvolutionImage = server.EvolutionImage
+	}
+
+	managerUrl := strings.TrimRight(os.Getenv("MANAGER_URL"), "/")
+	if managerUrl != "" && server.WebhookToken != "" {
+		params.WebhookURL = managerUrl + "/webhooks/evolution/" + server.WebhookToken
+	}
+
+	return params
+}
+
+// Render renderiza as stacks com os parâmetros informados.
+func Render(params Params) ([]File, error) {
+	var rendered []File
+
+	for _, file := range files {
+		var content bytes.Buffer
+		if err := templates.ExecuteTemplate(&content, file.Name+".tmpl", params); err != nil {
+			return nil, err
+		}
+
+		rendered = append(rendered, File{Name: file.Name, Stack: file.Stack, Content: content.String()})
+	}
+
+	return rendered, nil
+}
+
+// Save renderiza as stacks do servidor e grava uma nova revisão quando o
+// resultado difere da última gravada. A revisão é gravada, e o hash
+// calculado, sem os segredos (veja redact); por isso trocar só a API key ou o
+// token do webhook não gera revisão nova. Retorna a revisão que deve estar
+// rodando no servidor e os arquivos completos, que são os implantados.
+func Save(server models.Server, params Params) (models.StackRevision, []File, error) {
+	rendered, err := Render(params)
+	if err != nil {
+		return models.StackRevision{}, nil, err
+	}
+
+	content, hash, err := encode(redact(rendered))
+	if err != nil {
+		return models.StackRevision{}, nil, err
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return models.StackRevision{}, nil, err
+	}
+
+	var revision models.StackRevision
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		var latest models.StackRevision
+		err := tx.Where("server_id = ?", server.ID).Order("revision DESC").First(&latest).Error
+		if err == nil && latest.Hash == hash {
+			revision = latest
+			return nil
+		}
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		revision = models.StackRevision{
+			ServerID:       server.ID,
+			Revision:       latest.Revision + 1,
+			Hash:           hash,
+			EvolutionImage: params.EvolutionImage,
+			Params:         string(paramsJSON),
+			Files:          content,
+		}
+		return tx.Create(&revision).Error
+	})
+	if err != nil {
+		return models.StackRevision{}, nil, err
+	}
+
+	return revision, rendered, nil
+}
+
+func quote(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+func envOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,64 @@
+package stacks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	const (
+		apiKey = "chave-secreta"
+		token  = "0123456789abcdef"
+	)
+	rendered, err := Render(Params{
+		APIKey:         apiKey,
+		ServerURL:      "http://eapi.shub.tech:8080",
+		EvolutionImage: "evolution:1",
+		WebhookURL:     "https://manager.shub.tech/webhooks/evolution/" + token,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range redact(rendered) {
+		if strings.Contains(file.Content, apiKey) || strings.Contains(file.Content, token) {
+			t.Errorf("%s ainda tem segredos:\n%s", file.Name, file.Content)
+		}
+		if file.Stack != "evolution" {
+			continue
+		}
+		for _, want := range []string{
+			`AUTHENTICATION_API_KEY: "[REDACTED]"`,
+			`WEBHOOK_GLOBAL_URL: "https://manager.shub.tech/webhooks/evolution/[REDACTED]"`,
+			`evolution:1`,
+		} {
+			if !strings.Contains(file.Content, want) {
+				t.Errorf("%s sem %q", file.Name, want)
+			}
+		}
+	}
+
+	// Os arquivos implantados continuam com os segredos.
+	if !strings.Contains(rendered[2].Content, apiKey) || !strings.Contains(rendered[2].Content, token) {
+		t.Error("redact alterou os arquivos renderizados")
+	}
+}
+
+func TestRedactIsIdempotent(t *testing.T) {
+	rendered, err := Render(Params{APIKey: "chave", WebhookURL: "https://manager/webhooks/evolution/token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	once, hash, err := encode(redact(rendered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, rehash, err := encode(redact(redact(rendered)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if once != twice || hash != rehash {
+		t.Error("redact mudou arquivos já sem segredos")
+	}
+}
@@ -0,0 +1,98 @@
+package swarm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/remote"
+	"golang.org/x/crypto/ssh"
+)
+
+// dockerSocket é o socket da Docker Engine API no servidor.
+const dockerSocket = "/var/run/docker.sock"
+
+// Client fala com a Docker Engine API de um servidor através de um túnel SSH
+// até o socket do Docker, sem expor a API na rede.
+type Client struct {
+	ssh  *ssh.Client
+	http *http.Client
+}
+
+// Connect abre o túnel SSH para o servidor. Quem chama deve chamar Close.
+func Connect(server *models.Server) (*Client, error) {
+	sshClient, err := remote.Dial(server)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return sshClient.Dial("unix", dockerSocket)
+		},
+		MaxIdleConns:    1,
+		IdleConnTimeout: 30 * time.Second,
+	}
+
+	return &Client{
+		ssh:  sshClient,
+		http: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (c *Client) Close() error {
+	c.http.CloseIdleConnections()
+	return c.ssh.Close()
+}
+
+// get faz um GET na API do Docker e decodifica a resposta em out.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body io.Reader, out interface{}) error {
+	endpoint := "http://docker" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("docker: %s %s: status %d: %s", method, path, resp.StatusCode, apiErr.Message)
+	}
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// filters monta o parâmetro filters da API do Docker.
+func filters(key string, values ...string) url.Values {
+	encoded, _ := json.Marshal(map[string][]string{key: values})
+	return url.Values{"filters": {string(encoded)}}
+}
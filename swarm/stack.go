@@ -0,0 +1,141 @@
+package swarm
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// StackStatus é o estado de uma stack do Swarm em um servidor.
+type StackStatus struct {
+	Stack    string          `json:"stack"`
+	Services []ServiceStatus `json:"services"`
+}
+
+// ServiceStatus resume um serviço e suas tasks.
+type ServiceStatus struct {
+	ID              string       `json:"id"`
+	Name            string       `json:"name"`
+	Image           string       `json:"image"`
+	DesiredReplicas uint64       `json:"desired_replicas"`
+	RunningReplicas uint64       `json:"running_replicas"`
+	Tasks           []TaskStatus `json:"tasks"`
+}
+
+// TaskStatus é uma task (container) de um serviço.
+type TaskStatus struct {
+	ID           string    `json:"id"`
+	Slot         int       `json:"slot"`
+	State        string    `json:"state"`
+	DesiredState string    `json:"desired_state"`
+	Message      string    `json:"message"`
+	Error        string    `json:"error"`
+	ContainerID  string    `json:"container_id"`
+	ExitCode     int       `json:"exit_code"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// service é o subconjunto de um serviço da Docker Engine API usado aqui.
+// Spec é mantido cru para que possa ser devolvido intacto em atualizações.
+type service struct {
+	ID      string `json:"ID"`
+	Version struct {
+		Index uint64 `json:"Index"`
+	} `json:"Version"`
+	Spec         json.RawMessage `json:"Spec"`
+	UpdateStatus *struct {
+		State   string `json:"State"`
+		Message string `json:"Message"`
+	} `json:"UpdateStatus"`
+	ServiceStatus *struct {
+		RunningTasks uint64 `json:"RunningTasks"`
+		DesiredTasks uint64 `json:"DesiredTasks"`
+	} `json:"ServiceStatus"`
+}
+
+type serviceSpec struct {
+	Name         string `json:"Name"`
+	TaskTemplate struct {
+		ContainerSpec struct {
+			Image string `json:"Image"`
+		} `json:"ContainerSpec"`
+	} `json:"TaskTemplate"`
+}
+
+type task struct {
+	ID           string    `json:"ID"`
+	ServiceID    string    `json:"ServiceID"`
+	Slot         int       `json:"Slot"`
+	DesiredState string    `json:"DesiredState"`
+	UpdatedAt    time.Time `json:"UpdatedAt"`
+	Status       struct {
+		State           string `json:"State"`
+		Message         string `json:"Message"`
+		Err             string `json:"Err"`
+		ContainerStatus struct {
+			ContainerID string `json:"ContainerID"`
+			ExitCode    int    `json:"ExitCode"`
+		} `json:"ContainerStatus"`
+	} `json:"Status"`
+}
+
+// services lista os serviços da stack informada.
+func (c *Client) services(ctx context.Context, stack string) ([]service, error) {
+	query := filters("label", "com.docker.stack.namespace="+stack)
+	query.Set("status", "true")
+
+	var services []service
+	err := c.get(ctx, "/services", query, &services)
+	return services, err
+}
+
+// Stack retorna os serviços da stack com réplicas e tasks de cada um.
+func (c *Client) Stack(ctx context.Context, stack string) (StackStatus, error) {
+	status := StackStatus{Stack: stack, Services: []ServiceStatus{}}
+
+	services, err := c.services(ctx, stack)
+	if err != nil {
+		return status, err
+	}
+
+	for _, svc := range services {
+		var spec serviceSpec
+		if err := json.Unmarshal(svc.Spec, &spec); err != nil {
+			return status, err
+		}
+
+		serviceStatus := ServiceStatus{
+			ID:    svc.ID,
+			Name:  spec.Name,
+			Image: spec.TaskTemplate.ContainerSpec.Image,
+			Tasks: []TaskStatus{},
+		}
+		if svc.ServiceStatus != nil {
+			serviceStatus.DesiredReplicas = svc.ServiceStatus.DesiredTasks
+			serviceStatus.RunningReplicas = svc.ServiceStatus.RunningTasks
+		}
+
+		var tasks []task
+		if err := c.get(ctx, "/tasks", filters("service", svc.ID), &tasks); err != nil {
+			return status, err
+		}
+
+		for _, t := range tasks {
+			serviceStatus.Tasks = append(serviceStatus.Tasks, TaskStatus{
+				ID:           t.ID,
+				Slot:         t.Slot,
+				State:        t.Status.State,
+				DesiredState: t.DesiredState,
+				Message:      t.Status.Message,
+				Error:        t.Status.Err,
+				ContainerID:  t.Status.ContainerStatus.ContainerID,
+				ExitCode:     t.Status.ContainerStatus.ExitCode,
+				UpdatedAt:    t.UpdatedAt,
+			})
+		}
+
+		status.Services = append(status.Services, serviceStatus)
+	}
+
+	return status, nil
+}
@@ -0,0 +1,93 @@
+package swarm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// findService retorna o serviço da stack com o nome informado (sem o
+// prefixo da stack, ex.: "evolution_api").
+func (c *Client) findService(ctx context.Context, stack string, name string) (service, error) {
+	services, err := c.services(ctx, stack)
+	if err != nil {
+		return service{}, err
+	}
+
+	for _, svc := range services {
+		var spec serviceSpec
+		if err := json.Unmarshal(svc.Spec, &spec); err != nil {
+			return service{}, err
+		}
+		if spec.Name == stack+"_"+name {
+			return svc, nil
+		}
+	}
+
+	return service{}, fmt.Errorf("serviço %s_%s não encontrado", stack, name)
+}
+
+// UpdateImage troca a imagem do serviço, mantendo o resto da spec. O Swarm
+// faz o rolling update das tasks.
+func (c *Client) UpdateImage(ctx context.Context, stack string, name string, image string) error {
+	svc, err := c.findService(ctx, stack, name)
+	if err != nil {
+		return err
+	}
+
+	var spec map[string]interface{}
+	if err := json.Unmarshal(svc.Spec, &spec); err != nil {
+		return err
+	}
+
+	taskTemplate, _ := spec["TaskTemplate"].(map[string]interface{})
+	containerSpec, _ := taskTemplate["ContainerSpec"].(map[string]interface{})
+	if containerSpec == nil {
+		return fmt.Errorf("serviço %s sem ContainerSpec", svc.ID)
+	}
+	containerSpec["Image"] = image
+
+	body, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"version": {fmt.Sprint(svc.Version.Index)}}
+	return c.do(ctx, "POST", "/services/"+svc.ID+"/update", query, bytes.NewReader(body), nil)
+}
+
+// WaitConverged espera o rolling update do serviço terminar com todas as
+// réplicas rodando. Falha se o Swarm pausar ou reverter o update.
+func (c *Client) WaitConverged(ctx context.Context, stack string, name string, interval time.Duration) error {
+	for {
+		svc, err := c.findService(ctx, stack, name)
+		if err != nil {
+			return err
+		}
+
+		updateState := ""
+		if svc.UpdateStatus != nil {
+			updateState = svc.UpdateStatus.State
+		}
+
+		switch updateState {
+		case "paused", "rollback_started", "rollback_paused", "rollback_completed":
+			return fmt.Errorf("update do serviço %s_%s: %s (%s)", stack, name, updateState, svc.UpdateStatus.Message)
+		}
+
+		converged := updateState == "" || updateState == "completed"
+		if converged && svc.ServiceStatus != nil && svc.ServiceStatus.DesiredTasks > 0 &&
+			svc.ServiceStatus.RunningTasks == svc.ServiceStatus.DesiredTasks {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("serviço %s_%s não convergiu: %w", stack, name, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget indica uma URL de assinatura que aponta para a rede
+// interna (loopback, faixas privadas, link-local, metadados da nuvem...).
+var ErrForbiddenTarget = errors.New("destino do webhook não permitido")
+
+// dialTimeout é o tempo máximo para abrir a conexão com o cliente.
+const dialTimeout = 5 * time.Second
+
+// dialer recusa a conexão com endereços internos no momento do envio, e não
+// só na criação da assinatura: o DNS do cliente pode mudar depois, e um
+// redirect pode apontar para outro host.
+var dialer = &net.Dialer{
+	Timeout: dialTimeout,
+	Control: func(network, address string, conn syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return fmt.Errorf("%w: %s", ErrForbiddenTarget, host)
+		}
+		return checkIP(ip)
+	},
+}
+
+// ValidateURL verifica a URL de uma assinatura: só http e https, e o host
+// não pode resolver para um endereço interno.
+func ValidateURL(ctx context.Context, raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("%w: esquema %q", ErrForbiddenTarget, target.Scheme)
+	}
+	host := target.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: host vazio", ErrForbiddenTarget)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return checkIP(ip)
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if err := checkIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkIP(ip net.IP) error {
+	if allowPrivate() {
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, ip)
+	}
+	return nil
+}
+
+// allowPrivate lê WEBHOOK_ALLOW_PRIVATE, que libera endereços internos (ex.:
+// clientes na mesma rede em desenvolvimento).
+func allowPrivate() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE"))
+	return allow
+}
@@ -0,0 +1,443 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felipe-tecsa/whatsapp-swarm-manager-api/models"
+)
+
+const (
+	// pollInterval é o intervalo entre as varreduras de entregas pendentes.
+	pollInterval = 5 * time.Second
+	// batchSize limita as entregas feitas em cada varredura.
+	batchSize = 100
+	// deliveryTimeout é o tempo máximo de cada tentativa.
+	deliveryTimeout = 10 * time.Second
+	// pruneInterval é o intervalo entre as limpezas do log de entregas.
+	pruneInterval = time.Hour
+
+	defaultMaxAttempts = 8
+	defaultWorkers     = 10
+	defaultRetention   = 7 * 24 * time.Hour
+	baseBackoff        = 30 * time.Second
+	maxBackoff         = time.Hour
+
+	// defaultMaxPayload limita os dados gravados em cada entrega; eventos
+	// maiores (ex.: messages.upsert com mídia em base64) são reduzidos, ver
+	// compactData.
+	defaultMaxPayload = 256 << 10
+)
+
+// Headers enviados em cada entrega. A assinatura é o HMAC-SHA256, em hex, de
+// "<timestamp>.<corpo>" com o secret da assinatura.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+var client = &http.Client{
+	Timeout:   deliveryTimeout,
+	Transport: &http.Transport{DialContext: dialer.DialContext},
+}
+
+// wake acorda o worker quando novas entregas são criadas, para que não
+// esperem a próxima varredura.
+var wake = make(chan struct{}, 1)
+
+// Event é o payload enviado aos clientes: o evento da Evolution acrescido
+// do servidor e do tenant da instância. Truncated indica que Data foi
+// reduzido para caber no limite do payload (ver compactData).
+type Event struct {
+	Event     string          `json:"event"`
+	Instance  string          `json:"instance"`
+	ServerID  int             `json:"server_id"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	DateTime  string          `json:"date_time"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// Dispatch cria uma entrega para cada assinatura da instância (ou do tenant
+// dela) que assina o evento. Uma assinatura por nome com tenant só vale
+// para a instância desse tenant. O envio é feito pelo worker da réplica
+// líder (ver Run); em outra réplica a entrega espera a próxima varredura.
+func Dispatch(instance models.Instance, event models.EvolutionEvent) error {
+	var subscriptions []models.WebhookSubscription
+	err := models.DB.Where("disabled = ?", false).
+		Where("(instance_name = ? AND (tenant = '' OR tenant = ?)) OR (instance_name = '' AND tenant <> '' AND tenant = ?)",
+			instance.Name, instance.Tenant, instance.Tenant).
+		Find(&subscriptions).Error
+	if err != nil {
+		return err
+	}
+
+	data, truncated := compactData(event.Data)
+	payload, err := json.Marshal(Event{
+		Event:     event.Event,
+		Instance:  instance.Name,
+		ServerID:  instance.ServerID,
+		Tenant:    instance.Tenant,
+		Data:      data,
+		DateTime:  event.DateTime,
+		Truncated: truncated,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var deliveries []models.WebhookDelivery
+	for _, subscription := range subscriptions {
+		if !subscribed(subscription, event.Event) {
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			Event:          event.Event,
+			InstanceName:   instance.Name,
+			Payload:        string(payload),
+			State:          models.DeliveryPending,
+			NextAttemptAt:  now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := models.DB.Create(&deliveries).Error; err != nil {
+		return err
+	}
+	notify()
+	return nil
+}
+
+// Replay reenvia uma entrega, criando uma nova com o mesmo payload. A
+// original fica no log como estava.
+func Replay(deliveryID int) (models.WebhookDelivery, error) {
+	var original models.WebhookDelivery
+	if err := models.DB.Where("id = ?", deliveryID).First(&original).Error; err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	replay := models.WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		Event:          original.Event,
+		InstanceName:   original.InstanceName,
+		Payload:        original.Payload,
+		State:          models.DeliveryPending,
+		NextAttemptAt:  time.Now(),
+		ReplayOf:       original.ID,
+	}
+	if err := models.DB.Create(&replay).Error; err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	notify()
+	return replay, nil
+}
+
+// Run executa o worker de entregas até o contexto ser cancelado. A cada
+// pruneInterval o log de entregas antigas é limpo (ver Prune).
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(pruneInterval)
+	defer pruneTicker.Stop()
+
+	Prune()
+	for {
+		ProcessPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		case <-pruneTicker.C:
+			Prune()
+		}
+	}
+}
+
+// ProcessPending envia as entregas pendentes cujo horário de tentativa já
+// chegou. As entregas de cada assinatura são enviadas em ordem, e as
+// assinaturas em paralelo, até WEBHOOK_WORKERS por vez, para que um
+// endpoint fora do ar não atrase os demais.
+func ProcessPending(ctx context.Context) {
+	var deliveries []models.WebhookDelivery
+
+	err := models.DB.Where("state = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+		Order("next_attempt_at, id").
+		Limit(batchSize).
+		Find(&deliveries).Error
+	if err != nil {
+		fmt.Println("Erro ao buscar entregas de webhook:", err)
+		return
+	}
+
+	var order []int
+	groups := map[int][]models.WebhookDelivery{}
+	for _, delivery := range deliveries {
+		if _, ok := groups[delivery.SubscriptionID]; !ok {
+			order = append(order, delivery.SubscriptionID)
+		}
+		groups[delivery.SubscriptionID] = append(groups[delivery.SubscriptionID], delivery)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, workers())
+	for _, subscriptionID := range order {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(group []models.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			deliverGroup(ctx, group)
+		}(groups[subscriptionID])
+	}
+	wg.Wait()
+}
+
+// deliverGroup envia, em ordem, entregas de uma mesma assinatura. Na
+// primeira falha as restantes são adiadas para a próxima tentativa da que
+// falhou, em vez de esperar o timeout uma a uma.
+func deliverGroup(ctx context.Context, group []models.WebhookDelivery) {
+	var subscription *models.WebhookSubscription
+	var found models.WebhookSubscription
+	if err := models.DB.Where("id = ?", group[0].SubscriptionID).First(&found).Error; err == nil {
+		subscription = &found
+	}
+
+	for i := range group {
+		if ctx.Err() != nil {
+			return
+		}
+
+		delivery := &group[i]
+		attempt(ctx, subscription, delivery)
+		if err := models.DB.Save(delivery).Error; err != nil {
+			fmt.Println("Erro ao salvar entrega de webhook:", err)
+		}
+		if delivery.State == models.DeliveryDelivered || subscription == nil || subscription.Disabled {
+			continue
+		}
+
+		next := delivery.NextAttemptAt
+		if delivery.State != models.DeliveryPending {
+			next = time.Now().Add(baseBackoff)
+		}
+		var rest []int
+		for _, pending := range group[i+1:] {
+			rest = append(rest, pending.ID)
+		}
+		if len(rest) > 0 {
+			err := models.DB.Model(&models.WebhookDelivery{}).Where("id IN ?", rest).
+				Update("next_attempt_at", next).Error
+			if err != nil {
+				fmt.Println("Erro ao adiar entregas de webhook:", err)
+			}
+		}
+		return
+	}
+}
+
+// Prune apaga as entregas concluídas (delivered ou failed) criadas há mais
+// de WEBHOOK_RETENTION_DAYS dias. Entregas pendentes são mantidas.
+func Prune() {
+	result := models.DB.Where("state IN ? AND created_at < ?",
+		[]string{models.DeliveryDelivered, models.DeliveryFailed}, time.Now().Add(-retention())).
+		Delete(&models.WebhookDelivery{})
+	if result.Error != nil {
+		fmt.Println("Erro ao limpar entregas de webhook:", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		fmt.Printf("%d entregas de webhook antigas apagadas\n", result.RowsAffected)
+	}
+}
+
+// attempt faz uma tentativa de entrega e atualiza o estado dela.
+func attempt(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+
+	if subscription == nil || subscription.Disabled {
+		delivery.State = models.DeliveryFailed
+		delivery.LastError = "assinatura removida ou desativada"
+		return
+	}
+
+	statusCode, err := send(ctx, *subscription, *delivery)
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		now := time.Now()
+		delivery.State = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= maxAttempts() {
+		delivery.State = models.DeliveryFailed
+		return
+	}
+	delivery.NextAttemptAt = time.Now().Add(backoff(delivery.Attempts))
+}
+
+func send(ctx context.Context, subscription models.WebhookSubscription, delivery models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(subscription.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign calcula a assinatura enviada em X-Webhook-Signature (sem o prefixo
+// sha256=). Os clientes devem recalculá-la e comparar antes de aceitar o
+// evento.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff dobra a espera a cada tentativa, de 30s até 1h.
+func backoff(attempts int) time.Duration {
+	wait := baseBackoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
+
+func subscribed(subscription models.WebhookSubscription, event string) bool {
+	if strings.TrimSpace(subscription.Events) == "" {
+		return true
+	}
+	for _, name := range strings.Split(subscription.Events, ",") {
+		if strings.TrimSpace(name) == event {
+			return true
+		}
+	}
+	return false
+}
+
+func notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// compactData reduz os dados do evento que passam de
+// WEBHOOK_MAX_PAYLOAD_BYTES: primeiro remove os campos base64 (mídia, que o
+// cliente pode buscar na Evolution); se ainda passar, os dados são
+// descartados. truncated informa se houve redução.
+func compactData(data json.RawMessage) (json.RawMessage, bool) {
+	limit := maxPayload()
+	if len(data) <= limit {
+		return data, false
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err == nil {
+		if compacted, err := json.Marshal(stripBase64(value)); err == nil && len(compacted) <= limit {
+			return compacted, true
+		}
+	}
+	return json.RawMessage("null"), true
+}
+
+func stripBase64(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			if key == "base64" {
+				delete(typed, key)
+				continue
+			}
+			typed[key] = stripBase64(item)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = stripBase64(item)
+		}
+	}
+	return value
+}
+
+// maxAttempts lê WEBHOOK_MAX_ATTEMPTS; depois dessa quantidade de falhas a
+// entrega fica como failed e só volta com replay.
+func maxAttempts() int {
+	value, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+	if err != nil || value <= 0 {
+		return defaultMaxAttempts
+	}
+	return value
+}
+
+// workers lê WEBHOOK_WORKERS, o número de assinaturas atendidas em paralelo.
+func workers() int {
+	value, err := strconv.Atoi(os.Getenv("WEBHOOK_WORKERS"))
+	if err != nil || value <= 0 {
+		return defaultWorkers
+	}
+	return value
+}
+
+// retention lê WEBHOOK_RETENTION_DAYS, por quanto tempo o log de entregas
+// concluídas é mantido.
+func retention() time.Duration {
+	value, err := strconv.Atoi(os.Getenv("WEBHOOK_RETENTION_DAYS"))
+	if err != nil || value <= 0 {
+		return defaultRetention
+	}
+	return time.Duration(value) * 24 * time.Hour
+}
+
+// maxPayload lê WEBHOOK_MAX_PAYLOAD_BYTES, o tamanho máximo dos dados de um
+// evento gravados na entrega.
+func maxPayload() int {
+	value, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_PAYLOAD_BYTES"))
+	if err != nil || value <= 0 {
+		return defaultMaxPayload
+	}
+	return value
+}
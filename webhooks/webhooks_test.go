@@ -0,0 +1,67 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		allowed bool
+	}{
+		{"public", "https://203.0.113.10/hook", true},
+		{"loopback", "http://127.0.0.1:8080/hook", false},
+		{"private", "http://10.0.0.5/hook", false},
+		{"metadata", "http://169.254.169.254/latest/meta-data", false},
+		{"unspecified", "http://0.0.0.0/hook", false},
+		{"ipv6 loopback", "http://[::1]/hook", false},
+		{"mapped loopback", "http://[::ffff:127.0.0.1]/hook", false},
+		{"scheme", "ftp://203.0.113.10/hook", false},
+		{"no host", "http:///hook", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateURL(context.Background(), tt.url)
+			if tt.allowed && err != nil {
+				t.Fatalf("ValidateURL(%q) = %v, want nil", tt.url, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrForbiddenTarget) {
+				t.Fatalf("ValidateURL(%q) = %v, want ErrForbiddenTarget", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestValidateURLAllowPrivate(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+
+	if err := ValidateURL(context.Background(), "http://127.0.0.1:8080/hook"); err != nil {
+		t.Fatalf("ValidateURL com WEBHOOK_ALLOW_PRIVATE = %v, want nil", err)
+	}
+}
+
+func TestCompactData(t *testing.T) {
+	t.Setenv("WEBHOOK_MAX_PAYLOAD_BYTES", "200")
+
+	small := json.RawMessage(`{"key":{"id":"1"}}`)
+	if data, truncated := compactData(small); truncated || string(data) != string(small) {
+		t.Fatalf("dados pequenos alterados: %s (truncated=%v)", data, truncated)
+	}
+
+	media := json.RawMessage(`{"key":{"id":"1"},"message":{"base64":"` + strings.Repeat("A", 500) + `"}}`)
+	data, truncated := compactData(media)
+	if !truncated || strings.Contains(string(data), "base64") || !strings.Contains(string(data), `"id":"1"`) {
+		t.Fatalf("base64 não removido: %s (truncated=%v)", data, truncated)
+	}
+
+	large := json.RawMessage(`{"text":"` + strings.Repeat("A", 500) + `"}`)
+	if data, truncated := compactData(large); !truncated || string(data) != "null" {
+		t.Fatalf("dados grandes mantidos: %s (truncated=%v)", data, truncated)
+	}
+}